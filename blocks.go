@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/curtisbraxdale/chirpy/internal/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Blocking hides two users from each other everywhere chirps are read. Muting
+// only hides the muted user from the muter's chirp feed and notifications.
+
+type RelatedUser struct {
+	ID          uuid.UUID `json:"id"`
+	Handle      string    `json:"handle"`
+	DisplayName string    `json:"display_name"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// relationTarget authenticates the caller and reads the other user from the
+// request path, writing the error response itself when it fails.
+func (cfg *apiConfig) relationTarget(w http.ResponseWriter, req *http.Request) (uuid.UUID, uuid.UUID, bool) {
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		respondAuthError(w, req, err)
+		return uuid.Nil, uuid.Nil, false
+	}
+	targetID, err := uuid.Parse(req.PathValue("userID"))
+	if err != nil {
+		requestLogger(req).Warn("Error parsing uuid", "error", err)
+		w.WriteHeader(400)
+		return uuid.Nil, uuid.Nil, false
+	}
+	if targetID == userID {
+		respondWithError(w, 400, "Can't block or mute yourself")
+		return uuid.Nil, uuid.Nil, false
+	}
+	return userID, targetID, true
+}
+
+// isForeignKeyViolation reports whether err came from a missing referenced row.
+func isForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503"
+}
+
+// isUniqueViolation reports whether err came from a duplicate key.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+func (cfg *apiConfig) blockHandler(w http.ResponseWriter, req *http.Request) {
+	userID, targetID, ok := cfg.relationTarget(w, req)
+	if !ok {
+		return
+	}
+	err := cfg.queries.CreateBlock(context.Background(), database.CreateBlockParams{BlockerID: userID, BlockedID: targetID})
+	if isForeignKeyViolation(err) {
+		w.WriteHeader(404)
+		return
+	}
+	if err != nil {
+		requestLogger(req).Error("Error blocking user", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+func (cfg *apiConfig) unblockHandler(w http.ResponseWriter, req *http.Request) {
+	userID, targetID, ok := cfg.relationTarget(w, req)
+	if !ok {
+		return
+	}
+	err := cfg.queries.DeleteBlock(context.Background(), database.DeleteBlockParams{BlockerID: userID, BlockedID: targetID})
+	if err != nil {
+		requestLogger(req).Error("Error unblocking user", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+func (cfg *apiConfig) listBlocksHandler(w http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		respondAuthError(w, req, err)
+		return
+	}
+	limit, offset, err := parsePagination(req)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	dbBlocks, err := cfg.queries.ListBlocks(context.Background(), database.ListBlocksParams{BlockerID: userID, Limit: limit, Offset: offset})
+	if err != nil {
+		requestLogger(req).Error("Error listing blocks", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	blocked := []RelatedUser{}
+	for _, b := range dbBlocks {
+		blocked = append(blocked, RelatedUser{ID: b.ID, Handle: b.Handle.String, DisplayName: b.DisplayName, CreatedAt: b.CreatedAt})
+	}
+	respondWithJSON(w, 200, blocked)
+}
+
+func (cfg *apiConfig) muteHandler(w http.ResponseWriter, req *http.Request) {
+	userID, targetID, ok := cfg.relationTarget(w, req)
+	if !ok {
+		return
+	}
+	err := cfg.queries.CreateMute(context.Background(), database.CreateMuteParams{MuterID: userID, MutedID: targetID})
+	if isForeignKeyViolation(err) {
+		w.WriteHeader(404)
+		return
+	}
+	if err != nil {
+		requestLogger(req).Error("Error muting user", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+func (cfg *apiConfig) unmuteHandler(w http.ResponseWriter, req *http.Request) {
+	userID, targetID, ok := cfg.relationTarget(w, req)
+	if !ok {
+		return
+	}
+	err := cfg.queries.DeleteMute(context.Background(), database.DeleteMuteParams{MuterID: userID, MutedID: targetID})
+	if err != nil {
+		requestLogger(req).Error("Error unmuting user", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+func (cfg *apiConfig) listMutesHandler(w http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		respondAuthError(w, req, err)
+		return
+	}
+	limit, offset, err := parsePagination(req)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	dbMutes, err := cfg.queries.ListMutes(context.Background(), database.ListMutesParams{MuterID: userID, Limit: limit, Offset: offset})
+	if err != nil {
+		requestLogger(req).Error("Error listing mutes", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	muted := []RelatedUser{}
+	for _, m := range dbMutes {
+		muted = append(muted, RelatedUser{ID: m.ID, Handle: m.Handle.String, DisplayName: m.DisplayName, CreatedAt: m.CreatedAt})
+	}
+	respondWithJSON(w, 200, muted)
+}
@@ -0,0 +1,96 @@
+// Command polka-sim sends signed Polka webhooks to a running Chirpy, for
+// testing billing flows offline. It signs with POLKA_WEBHOOK_SECRETS or
+// POLKA_KEY, read the same way the server reads them.
+//
+//	go run ./cmd/polka-sim -event upgraded -user <user ID> -duplicates 1
+package main
+
+import (
+	"cmp"
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/curtisbraxdale/chirpy/internal/polkasim"
+	"github.com/google/uuid"
+	"github.com/joho/godotenv"
+)
+
+var events = map[string]string{
+	"upgraded":   polkasim.EventUpgraded,
+	"downgraded": polkasim.EventDowngraded,
+	"refunded":   polkasim.EventRefunded,
+}
+
+func main() {
+	url := flag.String("url", "http://localhost:8080/api/polka/webhooks", "Chirpy's Polka webhook URL")
+	eventName := flag.String("event", "upgraded", "event to send: upgraded, downgraded or refunded")
+	user := flag.String("user", "", "ID of the user the event is about")
+	period := flag.Duration("period", 30*24*time.Hour, "time until the subscription period ends; 0 leaves it out")
+	count := flag.Int("count", 1, "number of events to send")
+	failureRate := flag.Float64("failure-rate", 0, "fraction of attempts sent with a bad signature, from 0 to 1")
+	delay := flag.Duration("delay", 0, "delay before each attempt")
+	duplicates := flag.Int("duplicates", 0, "extra copies of each delivery to send once it is accepted")
+	attempts := flag.Int("attempts", 5, "attempts before giving up on a delivery")
+	retryBase := flag.Duration("retry-base", time.Second, "first retry delay, doubled on each retry")
+	seed := flag.Uint64("seed", 0, "seed for repeatable failures; 0 is random")
+	flag.Parse()
+
+	godotenv.Load()
+	secrets := []string{}
+	for _, secret := range strings.Split(cmp.Or(os.Getenv("POLKA_WEBHOOK_SECRETS"), os.Getenv("POLKA_KEY")), ",") {
+		if secret = strings.TrimSpace(secret); secret != "" {
+			secrets = append(secrets, secret)
+		}
+	}
+	if len(secrets) == 0 {
+		log.Fatalf("POLKA_WEBHOOK_SECRETS or POLKA_KEY must be set")
+	}
+	event, ok := events[*eventName]
+	if !ok {
+		log.Fatalf("Unknown event: %q", *eventName)
+	}
+	userID, err := uuid.Parse(*user)
+	if err != nil {
+		log.Fatalf("Invalid user ID: %q", *user)
+	}
+	periodEnd := time.Time{}
+	if *period > 0 {
+		periodEnd = time.Now().Add(*period)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	sim := polkasim.New(polkasim.Options{URL: *url, Secrets: secrets, FailureRate: *failureRate, Delay: *delay, Duplicates: *duplicates, MaxAttempts: *attempts, RetryBase: *retryBase, Seed: *seed})
+	failed := false
+	for range *count {
+		result, err := sim.Send(ctx, polkasim.NewEvent(event, userID, periodEnd))
+		for i, a := range result.Attempts {
+			status := "accepted"
+			if a.Err != nil {
+				status = a.Err.Error()
+			}
+			note := ""
+			if a.Sabotaged {
+				note = " (bad signature)"
+			} else if a.Duplicate {
+				note = " (duplicate)"
+			}
+			log.Printf("%s attempt %d: %s%s", result.ID, i+1, status, note)
+		}
+		if err != nil {
+			log.Printf("Error sending %s: %s", event, err)
+			failed = true
+			if ctx.Err() != nil {
+				break
+			}
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/curtisbraxdale/chirpy/internal/audit"
+	"github.com/curtisbraxdale/chirpy/internal/database"
+	"github.com/curtisbraxdale/chirpy/internal/filter"
+	"github.com/google/uuid"
+)
+
+// filterReloadInterval is how quickly rule changes made on another replica
+// take effect here.
+const filterReloadInterval = time.Minute
+
+type FilterRule struct {
+	// ID is empty for rules from the config file, which can't be changed
+	// through the API.
+	ID     *uuid.UUID    `json:"id"`
+	Term   string        `json:"term"`
+	Action filter.Action `json:"action"`
+	Source string        `json:"source"`
+}
+
+type ContentFlag struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	ChirpID   uuid.UUID `json:"chirp_id"`
+	UserID    uuid.UUID `json:"user_id"`
+	Body      string    `json:"body"`
+	Terms     []string  `json:"terms"`
+}
+
+// reloadFilter replaces the engine's rules with the config rules plus the
+// current rules in the database.
+func (cfg *apiConfig) reloadFilter() error {
+	dbRules, err := cfg.queries.ListFilterRules(context.Background())
+	if err != nil {
+		return err
+	}
+	rules := append([]filter.Rule{}, cfg.filterConfigRules...)
+	for _, r := range dbRules {
+		rules = append(rules, filter.Rule{Term: r.Term, Action: filter.Action(r.Action)})
+	}
+	cfg.filter.SetRules(rules)
+	return nil
+}
+
+func (cfg *apiConfig) runFilterReload(ctx context.Context) {
+	ticker := time.NewTicker(filterReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		err := cfg.reloadFilter()
+		if err != nil {
+			slog.Error("Error reloading content filter rules", "error", err)
+		}
+	}
+}
+
+func (cfg *apiConfig) listFilterRulesHandler(w http.ResponseWriter, req *http.Request) {
+	if _, ok := cfg.requireRole(w, req, roleAdmin); !ok {
+		return
+	}
+	dbRules, err := cfg.queries.ListFilterRules(context.Background())
+	if err != nil {
+		requestLogger(req).Error("Error listing filter rules", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	rules := []FilterRule{}
+	for _, r := range cfg.filterConfigRules {
+		rules = append(rules, FilterRule{Term: r.Term, Action: r.Action, Source: "config"})
+	}
+	for _, r := range dbRules {
+		rules = append(rules, FilterRule{ID: &r.ID, Term: r.Term, Action: filter.Action(r.Action), Source: "database"})
+	}
+	respondWithJSON(w, 200, rules)
+}
+
+// createFilterRuleHandler adds a rule, or changes the action of an existing
+// rule for the same term.
+func (cfg *apiConfig) createFilterRuleHandler(w http.ResponseWriter, req *http.Request) {
+	type parameters struct {
+		Term   string `json:"term"`
+		Action string `json:"action"`
+	}
+	adminID, ok := cfg.requireRole(w, req, roleAdmin)
+	if !ok {
+		return
+	}
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		requestLogger(req).Error("Error decoding parameters", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	term := strings.TrimSpace(params.Term)
+	if term == "" {
+		respondWithError(w, 400, "Term is required")
+		return
+	}
+	action, err := filter.ParseAction(params.Action)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	dbRule, err := cfg.queries.UpsertFilterRule(context.Background(), database.UpsertFilterRuleParams{Term: term, Action: string(action)})
+	if err != nil {
+		requestLogger(req).Error("Error saving filter rule", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	event := requestAuditEvent(req, audit.ActionFilterRuleSave)
+	event.ActorID = userActor(adminID)
+	event.TargetType, event.TargetID = "filter_rule", dbRule.ID.String()
+	event.After = map[string]any{"term": dbRule.Term, "action": dbRule.Action}
+	cfg.recordAudit(req.Context(), event)
+	err = cfg.reloadFilter()
+	if err != nil {
+		requestLogger(req).Error("Error reloading content filter rules", "error", err)
+	}
+	respondWithJSON(w, 201, FilterRule{ID: &dbRule.ID, Term: dbRule.Term, Action: action, Source: "database"})
+}
+
+func (cfg *apiConfig) deleteFilterRuleHandler(w http.ResponseWriter, req *http.Request) {
+	adminID, ok := cfg.requireRole(w, req, roleAdmin)
+	if !ok {
+		return
+	}
+	ruleID, err := uuid.Parse(req.PathValue("ruleID"))
+	if err != nil {
+		respondWithError(w, 400, "Invalid rule ID")
+		return
+	}
+	dbRule, err := cfg.queries.DeleteFilterRule(context.Background(), ruleID)
+	if errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(404)
+		return
+	}
+	if err != nil {
+		requestLogger(req).Error("Error deleting filter rule", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	event := requestAuditEvent(req, audit.ActionFilterRuleDelete)
+	event.ActorID = userActor(adminID)
+	event.TargetType, event.TargetID = "filter_rule", dbRule.ID.String()
+	event.Before = map[string]any{"term": dbRule.Term, "action": dbRule.Action}
+	cfg.recordAudit(req.Context(), event)
+	err = cfg.reloadFilter()
+	if err != nil {
+		requestLogger(req).Error("Error reloading content filter rules", "error", err)
+	}
+	w.WriteHeader(204)
+}
+
+// listContentFlagsHandler lists chirps that matched a flag rule, newest first.
+func (cfg *apiConfig) listContentFlagsHandler(w http.ResponseWriter, req *http.Request) {
+	if _, ok := cfg.requireRole(w, req, roleAdmin); !ok {
+		return
+	}
+	limit, offset, err := parsePagination(req)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	dbFlags, err := cfg.queries.ListContentFlags(context.Background(), database.ListContentFlagsParams{Limit: limit, Offset: offset})
+	if err != nil {
+		requestLogger(req).Error("Error listing content flags", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	flags := []ContentFlag{}
+	for _, f := range dbFlags {
+		flags = append(flags, ContentFlag{ID: f.ID, CreatedAt: f.CreatedAt, ChirpID: f.ChirpID, UserID: f.UserID, Body: f.Body, Terms: f.Terms})
+	}
+	respondWithJSON(w, 200, flags)
+}
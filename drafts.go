@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/curtisbraxdale/chirpy/internal/database"
+	"github.com/curtisbraxdale/chirpy/internal/entitlements"
+	"github.com/google/uuid"
+)
+
+const (
+	schedulerInterval = 15 * time.Second
+	// schedulerBatchSize caps how many drafts one transaction publishes.
+	schedulerBatchSize = 50
+)
+
+var errScheduleNotEntitled = errors.New("Your plan doesn't include scheduled chirps")
+
+// Draft is an unpublished chirp. Drafts with a publish time are scheduled.
+type Draft struct {
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	Body      string     `json:"body"`
+	PublishAt *time.Time `json:"publish_at"`
+	// Error says why a scheduled draft couldn't be published. The draft is
+	// unscheduled when that happens.
+	Error string `json:"error,omitempty"`
+}
+
+func newDraft(d database.Draft) Draft {
+	draft := Draft{ID: d.ID, CreatedAt: d.CreatedAt, UpdatedAt: d.UpdatedAt, Body: d.Body, Error: d.PublishError.String}
+	if d.PublishAt.Valid {
+		draft.PublishAt = &d.PublishAt.Time
+	}
+	return draft
+}
+
+func newDrafts(dbDrafts []database.Draft) []Draft {
+	drafts := []Draft{}
+	for _, d := range dbDrafts {
+		drafts = append(drafts, newDraft(d))
+	}
+	return drafts
+}
+
+type draftParameters struct {
+	Body      string     `json:"body"`
+	PublishAt *time.Time `json:"publish_at"`
+}
+
+// validateDraft applies the same rules as a new chirp, plus a publish time
+// in the future on a plan that allows scheduling.
+func validateDraft(params draftParameters, ents entitlements.Entitlements) []FieldError {
+	details := []FieldError{}
+	if fieldErr := validateChirpBody(params.Body, ents); fieldErr != nil {
+		details = append(details, *fieldErr)
+	}
+	if params.PublishAt != nil && !ents.Can(entitlements.ChirpSchedule) {
+		details = append(details, FieldError{Field: "publish_at", Code: "not_entitled", Message: errScheduleNotEntitled.Error()})
+	} else if params.PublishAt != nil && !params.PublishAt.After(time.Now()) {
+		details = append(details, FieldError{Field: "publish_at", Code: "in_past", Message: "Publish time must be in the future"})
+	}
+	return details
+}
+
+func publishAt(params draftParameters) sql.NullTime {
+	if params.PublishAt == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: *params.PublishAt, Valid: true}
+}
+
+func (cfg *apiConfig) createDraftHandler(w http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		respondAuthError(w, req, err)
+		return
+	}
+	decoder := json.NewDecoder(req.Body)
+	params := draftParameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		requestLogger(req).Error("Error decoding parameters", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	ents, err := cfg.entitlements(userID)
+	if err != nil {
+		requestLogger(req).Error("Error getting entitlements", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	if details := validateDraft(params, ents); len(details) > 0 {
+		respondWithValidationError(w, 400, details)
+		return
+	}
+	dbDraft, err := cfg.queries.CreateDraft(context.Background(), database.CreateDraftParams{UserID: userID, Body: params.Body, PublishAt: publishAt(params)})
+	if err != nil {
+		requestLogger(req).Error("Error creating draft", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	respondWithJSON(w, 201, newDraft(dbDraft))
+}
+
+func (cfg *apiConfig) listDraftsHandler(w http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		respondAuthError(w, req, err)
+		return
+	}
+	dbDrafts, err := cfg.queries.ListDrafts(context.Background(), userID)
+	if err != nil {
+		requestLogger(req).Error("Error listing drafts", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	respondWithJSON(w, 200, newDrafts(dbDrafts))
+}
+
+func (cfg *apiConfig) listScheduledHandler(w http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		respondAuthError(w, req, err)
+		return
+	}
+	dbDrafts, err := cfg.queries.ListScheduledDrafts(context.Background(), userID)
+	if err != nil {
+		requestLogger(req).Error("Error listing scheduled chirps", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	respondWithJSON(w, 200, newDrafts(dbDrafts))
+}
+
+// draftRequest authenticates the caller and parses the draft ID from the
+// path, writing the error response if either fails.
+func (cfg *apiConfig) draftRequest(w http.ResponseWriter, req *http.Request) (uuid.UUID, uuid.UUID, bool) {
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		respondAuthError(w, req, err)
+		return uuid.Nil, uuid.Nil, false
+	}
+	draftID, err := uuid.Parse(req.PathValue("draftID"))
+	if err != nil {
+		respondWithError(w, 400, "Invalid draft ID")
+		return uuid.Nil, uuid.Nil, false
+	}
+	return userID, draftID, true
+}
+
+func (cfg *apiConfig) getDraftHandler(w http.ResponseWriter, req *http.Request) {
+	userID, draftID, ok := cfg.draftRequest(w, req)
+	if !ok {
+		return
+	}
+	// Other users' drafts look the same as missing ones.
+	dbDraft, err := cfg.queries.GetDraft(context.Background(), database.GetDraftParams{ID: draftID, UserID: userID})
+	if errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(404)
+		return
+	}
+	if err != nil {
+		requestLogger(req).Error("Error getting draft", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	respondWithJSON(w, 200, newDraft(dbDraft))
+}
+
+func (cfg *apiConfig) updateDraftHandler(w http.ResponseWriter, req *http.Request) {
+	userID, draftID, ok := cfg.draftRequest(w, req)
+	if !ok {
+		return
+	}
+	decoder := json.NewDecoder(req.Body)
+	params := draftParameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		requestLogger(req).Error("Error decoding parameters", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	ents, err := cfg.entitlements(userID)
+	if err != nil {
+		requestLogger(req).Error("Error getting entitlements", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	if details := validateDraft(params, ents); len(details) > 0 {
+		respondWithValidationError(w, 400, details)
+		return
+	}
+	dbDraft, err := cfg.queries.UpdateDraft(context.Background(), database.UpdateDraftParams{ID: draftID, UserID: userID, Body: params.Body, PublishAt: publishAt(params)})
+	if errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(404)
+		return
+	}
+	if err != nil {
+		requestLogger(req).Error("Error updating draft", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	respondWithJSON(w, 200, newDraft(dbDraft))
+}
+
+func (cfg *apiConfig) deleteDraftHandler(w http.ResponseWriter, req *http.Request) {
+	userID, draftID, ok := cfg.draftRequest(w, req)
+	if !ok {
+		return
+	}
+	deleted, err := cfg.queries.DeleteDraft(context.Background(), database.DeleteDraftParams{ID: draftID, UserID: userID})
+	if err != nil {
+		requestLogger(req).Error("Error deleting draft", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	if deleted == 0 {
+		w.WriteHeader(404)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+// runScheduler publishes due drafts until the context is cancelled. Every
+// replica runs one.
+func (cfg *apiConfig) runScheduler(ctx context.Context) {
+	ticker := time.NewTicker(schedulerInterval)
+	defer ticker.Stop()
+	for {
+		for {
+			published, err := cfg.publishDueDrafts()
+			if err != nil {
+				slog.Error("Error publishing scheduled chirps", "error", err)
+			}
+			// A full batch means more may be waiting.
+			if err != nil || published < schedulerBatchSize {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// publishDueDrafts turns one batch of due drafts into chirps. The drafts are
+// locked with SKIP LOCKED and deleted in the same transaction that creates
+// their chirps, so each is published exactly once even with several
+// schedulers running. Drafts that no longer pass validation or fail to
+// insert are unscheduled with the reason.
+func (cfg *apiConfig) publishDueDrafts() (int, error) {
+	tx, err := cfg.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	qtx := cfg.queries.WithTx(tx)
+	dbDrafts, err := qtx.ListDueDrafts(context.Background(), schedulerBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	dbChirps := []database.Chirp{}
+	for _, d := range dbDrafts {
+		// The author's plan may have changed since the draft was saved.
+		ents, err := cfg.entitlements(d.UserID)
+		if err != nil {
+			return 0, err
+		}
+		reason := ""
+		if !ents.Can(entitlements.ChirpSchedule) {
+			reason = errScheduleNotEntitled.Error()
+		} else if fieldErr := validateChirpBody(d.Body, ents); fieldErr != nil {
+			reason = fieldErr.Message
+		}
+		if reason != "" {
+			err = qtx.FailDraft(context.Background(), database.FailDraftParams{ID: d.ID, PublishError: sql.NullString{String: reason, Valid: true}})
+			if err != nil {
+				return 0, err
+			}
+			continue
+		}
+		// A savepoint lets one bad draft fail without losing the batch.
+		_, err = tx.Exec("SAVEPOINT publish_draft")
+		if err != nil {
+			return 0, err
+		}
+		chirpParams := database.CreateChirpParams{Body: d.Body, UserID: d.UserID}
+		dbChirp, err := cfg.insertChirp(qtx, chirpParams, nil, nil)
+		if err != nil {
+			reason := "Chirp couldn't be published"
+			if errors.Is(err, errDuplicateChirp) || errors.Is(err, errRejectedChirp) {
+				reason = err.Error()
+			} else {
+				slog.Error("Error publishing draft", "draft_id", d.ID, "error", err)
+			}
+			_, err = tx.Exec("ROLLBACK TO SAVEPOINT publish_draft; RELEASE SAVEPOINT publish_draft")
+			if err != nil {
+				return 0, err
+			}
+			err = qtx.FailDraft(context.Background(), database.FailDraftParams{ID: d.ID, PublishError: sql.NullString{String: reason, Valid: true}})
+			if err != nil {
+				return 0, err
+			}
+			continue
+		}
+		_, err = tx.Exec("RELEASE SAVEPOINT publish_draft")
+		if err != nil {
+			return 0, err
+		}
+		_, err = qtx.DeleteDraft(context.Background(), database.DeleteDraftParams{ID: d.ID, UserID: d.UserID})
+		if err != nil {
+			return 0, err
+		}
+		dbChirps = append(dbChirps, dbChirp)
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, dbChirp := range dbChirps {
+		_, err := cfg.publishNewChirp(context.Background(), dbChirp)
+		if err != nil {
+			slog.Error("Error publishing chirp", "error", err)
+		}
+	}
+	return len(dbDrafts), nil
+}
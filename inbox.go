@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/curtisbraxdale/chirpy/internal/audit"
+	"github.com/curtisbraxdale/chirpy/internal/database"
+	"github.com/curtisbraxdale/chirpy/internal/notify"
+	"github.com/curtisbraxdale/chirpy/internal/webhook"
+	"github.com/google/uuid"
+)
+
+const (
+	inboxInterval  = 5 * time.Second
+	inboxBatchSize = 50
+	// maxWebhookAttempts is how many times an event is tried before it is
+	// dead-lettered as failed.
+	maxWebhookAttempts = 8
+	webhookRetryBase   = 30 * time.Second
+	webhookRetryMax    = time.Hour
+)
+
+const (
+	webhookPending   = "pending"
+	webhookProcessed = "processed"
+	webhookFailed    = "failed"
+)
+
+// permanentError marks a webhook event that will never succeed, so it is
+// dead-lettered without retries.
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e permanentError) Unwrap() error {
+	return e.err
+}
+
+type WebhookEvent struct {
+	ID            string     `json:"id"`
+	ReceivedAt    time.Time  `json:"received_at"`
+	Source        string     `json:"source"`
+	EventType     string     `json:"event_type"`
+	Status        string     `json:"status"`
+	Attempts      int32      `json:"attempts"`
+	NextAttemptAt time.Time  `json:"next_attempt_at"`
+	LastError     string     `json:"last_error,omitempty"`
+	ProcessedAt   *time.Time `json:"processed_at"`
+}
+
+func newWebhookEvent(e database.WebhookEvent) WebhookEvent {
+	event := WebhookEvent{ID: e.ID, ReceivedAt: e.ReceivedAt, Source: e.Source, EventType: e.EventType, Status: e.Status, Attempts: e.Attempts, NextAttemptAt: e.NextAttemptAt, LastError: e.LastError.String}
+	if e.ProcessedAt.Valid {
+		event.ProcessedAt = &e.ProcessedAt.Time
+	}
+	return event
+}
+
+// runWebhookInbox processes stored webhook events until the context is
+// cancelled. Every replica runs one.
+func (cfg *apiConfig) runWebhookInbox(ctx context.Context) {
+	ticker := time.NewTicker(inboxInterval)
+	defer ticker.Stop()
+	for {
+		for {
+			processed, err := cfg.processWebhookEvents()
+			if err != nil {
+				slog.Error("Error processing webhook events", "error", err)
+			}
+			// A full batch means more may be waiting.
+			if err != nil || processed < inboxBatchSize {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// processWebhookEvents works through one batch of due events. Each event's
+// changes and its new status are committed together, so an event is applied
+// exactly once. Failed events are retried with backoff and dead-lettered
+// after maxWebhookAttempts.
+func (cfg *apiConfig) processWebhookEvents() (int, error) {
+	tx, err := cfg.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	qtx := cfg.queries.WithTx(tx)
+	dbEvents, err := qtx.ListDueWebhookEvents(context.Background(), inboxBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	upgraded := []uuid.UUID{}
+	// Outcomes are counted once the batch is committed.
+	outcomes := make([]string, len(dbEvents))
+	for i, e := range dbEvents {
+		// A savepoint lets one bad event fail without losing the batch.
+		_, err = tx.Exec("SAVEPOINT process_webhook")
+		if err != nil {
+			return 0, err
+		}
+		welcome, err := processWebhookEvent(qtx, e)
+		if err != nil {
+			slog.Error("Error processing webhook event", "event_id", e.ID, "error", err)
+			_, err2 := tx.Exec("ROLLBACK TO SAVEPOINT process_webhook; RELEASE SAVEPOINT process_webhook")
+			if err2 != nil {
+				return 0, err2
+			}
+			lastError := sql.NullString{String: err.Error(), Valid: true}
+			var permanent permanentError
+			if errors.As(err, &permanent) || e.Attempts+1 >= maxWebhookAttempts {
+				outcomes[i] = webhookFailed
+				err = qtx.FailWebhookEvent(context.Background(), database.FailWebhookEventParams{ID: e.ID, LastError: lastError})
+			} else {
+				outcomes[i] = "retry"
+				retry := webhook.Backoff(int(e.Attempts)+1, webhookRetryBase, webhookRetryMax)
+				err = qtx.RetryWebhookEvent(context.Background(), database.RetryWebhookEventParams{ID: e.ID, LastError: lastError, RetrySeconds: retry.Seconds()})
+			}
+			if err != nil {
+				return 0, err
+			}
+			continue
+		}
+		_, err = tx.Exec("RELEASE SAVEPOINT process_webhook")
+		if err != nil {
+			return 0, err
+		}
+		err = qtx.MarkWebhookEventProcessed(context.Background(), e.ID)
+		if err != nil {
+			return 0, err
+		}
+		outcomes[i] = webhookProcessed
+		if welcome.Valid {
+			upgraded = append(upgraded, welcome.UUID)
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	for i, e := range dbEvents {
+		cfg.metrics.webhookEvents.WithLabelValues(e.Source, outcomes[i]).Inc()
+	}
+
+	// The upgrade has happened, so a failed notification isn't a webhook failure.
+	for _, userID := range upgraded {
+		err := cfg.notifier.Notify(context.Background(), notify.Event{Recipient: userID, Type: notify.TypeChirpyRed})
+		if err != nil {
+			slog.Error("Error notifying user", "error", err)
+		}
+	}
+	return len(dbEvents), nil
+}
+
+// processWebhookEvent hands an event to the processor for its source.
+func processWebhookEvent(q *database.Queries, event database.WebhookEvent) (uuid.NullUUID, error) {
+	switch event.Source {
+	case sourcePolka:
+		return processPolkaEvent(q, event)
+	}
+	return uuid.NullUUID{}, permanentError{fmt.Errorf("Unknown webhook source %q", event.Source)}
+}
+
+// listWebhookEventsHandler lists received webhook events by status, failed
+// ones by default.
+func (cfg *apiConfig) listWebhookEventsHandler(w http.ResponseWriter, req *http.Request) {
+	if _, ok := cfg.requireRole(w, req, roleAdmin); !ok {
+		return
+	}
+	status := req.URL.Query().Get("status")
+	if status == "" {
+		status = webhookFailed
+	}
+	if status != webhookPending && status != webhookProcessed && status != webhookFailed {
+		respondWithError(w, 400, "Invalid status")
+		return
+	}
+	limit, offset, err := parsePagination(req)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	dbEvents, err := cfg.queries.ListWebhookEvents(context.Background(), database.ListWebhookEventsParams{Status: status, Limit: limit, Offset: offset})
+	if err != nil {
+		requestLogger(req).Error("Error listing webhook events", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	events := []WebhookEvent{}
+	for _, e := range dbEvents {
+		events = append(events, newWebhookEvent(e))
+	}
+	respondWithJSON(w, 200, events)
+}
+
+// replayWebhookEventHandler queues a failed event to be processed again.
+func (cfg *apiConfig) replayWebhookEventHandler(w http.ResponseWriter, req *http.Request) {
+	adminID, ok := cfg.requireRole(w, req, roleAdmin)
+	if !ok {
+		return
+	}
+	eventID := req.PathValue("eventID")
+	replayed, err := cfg.queries.ReplayWebhookEvent(context.Background(), eventID)
+	if err != nil {
+		requestLogger(req).Error("Error replaying webhook event", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	if replayed == 0 {
+		respondWithError(w, 404, "No failed event with that ID")
+		return
+	}
+	event := requestAuditEvent(req, audit.ActionWebhookReplay)
+	event.ActorID = userActor(adminID)
+	event.TargetType, event.TargetID = "webhook_event", eventID
+	cfg.recordAudit(req.Context(), event)
+	w.WriteHeader(202)
+}
@@ -0,0 +1,87 @@
+// Package audit records privileged and security-relevant actions in the
+// append-only audit_events table.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+
+	"github.com/curtisbraxdale/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	ActionLogin        = "auth.login"
+	ActionLoginFailed  = "auth.login_failed"
+	ActionTokenRefresh = "auth.token_refresh"
+	ActionTokenRevoke  = "auth.token_revoke"
+	ActionUserUpdate   = "user.update"
+	ActionAdminReset   = "admin.reset"
+	// ActionFilterRuleSave covers both new rules and changed actions.
+	ActionFilterRuleSave   = "filter_rule.save"
+	ActionFilterRuleDelete = "filter_rule.delete"
+	ActionWebhookReplay    = "webhook.replay"
+	// ActionBilling is prefixed to the Polka event, as in
+	// "billing.user.upgraded".
+	ActionBilling = "billing."
+	// ActionModeration is prefixed to the moderation action, as in
+	// "moderation.ban".
+	ActionModeration = "moderation."
+)
+
+// Event is one entry in the audit log. ActorID is empty when nobody is
+// authenticated, as with a failed login.
+type Event struct {
+	ActorID    uuid.NullUUID
+	Action     string
+	TargetType string
+	TargetID   string
+	IP         string
+	UserAgent  string
+	// Before and After hold the fields the action touched. Only fields whose
+	// values differ are kept, so never put secrets in them.
+	Before map[string]any
+	After  map[string]any
+}
+
+// Change is one field's old and new values.
+type Change struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+// Diff returns the fields whose values differ between before and after. A
+// field missing on one side is nil there.
+func Diff(before, after map[string]any) map[string]Change {
+	changes := map[string]Change{}
+	for field, old := range before {
+		if updated := after[field]; !reflect.DeepEqual(old, updated) {
+			changes[field] = Change{Before: old, After: updated}
+		}
+	}
+	for field, updated := range after {
+		if _, ok := before[field]; !ok && updated != nil {
+			changes[field] = Change{After: updated}
+		}
+	}
+	return changes
+}
+
+// Record writes the event. Pass queries bound to a transaction to record the
+// event atomically with the action itself.
+func Record(ctx context.Context, queries *database.Queries, event Event) error {
+	changes, err := json.Marshal(Diff(event.Before, event.After))
+	if err != nil {
+		return err
+	}
+	return queries.CreateAuditEvent(ctx, database.CreateAuditEventParams{
+		ActorID:    event.ActorID,
+		Action:     event.Action,
+		TargetType: event.TargetType,
+		TargetID:   event.TargetID,
+		Ip:         event.IP,
+		UserAgent:  event.UserAgent,
+		Changes:    changes,
+	})
+}
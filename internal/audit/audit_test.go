@@ -0,0 +1,33 @@
+package audit
+
+import (
+	"testing"
+)
+
+// TestDiff tests that only changed fields are kept
+func TestDiff(t *testing.T) {
+	before := map[string]any{"email": "old@example.com", "handle": "same", "password_changed": false}
+	after := map[string]any{"email": "new@example.com", "handle": "same", "password_changed": true, "display_name": "New"}
+	changes := Diff(before, after)
+	if len(changes) != 3 {
+		t.Fatalf("Expected 3 changes, got %d: %v", len(changes), changes)
+	}
+	if changes["email"] != (Change{Before: "old@example.com", After: "new@example.com"}) {
+		t.Fatalf("Unexpected email change: %v", changes["email"])
+	}
+	if _, ok := changes["handle"]; ok {
+		t.Fatal("Unchanged field kept.")
+	}
+	if changes["password_changed"] != (Change{Before: false, After: true}) {
+		t.Fatalf("Unexpected password change: %v", changes["password_changed"])
+	}
+	if changes["display_name"] != (Change{After: "New"}) {
+		t.Fatalf("Unexpected display name change: %v", changes["display_name"])
+	}
+}
+
+func TestDiffEmpty(t *testing.T) {
+	if changes := Diff(nil, nil); len(changes) != 0 {
+		t.Fatalf("Expected no changes, got %v", changes)
+	}
+}
@@ -0,0 +1,436 @@
+// Package config loads and validates Chirpy's settings. Each setting has an
+// environment variable name, which is also its key in the optional config
+// file, and a command-line flag. Flags override the environment, which
+// overrides the file, which overrides the defaults.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+const (
+	PlatformDev  = "dev"
+	PlatformProd = "prod"
+
+	MediaLocal = "local"
+	MediaS3    = "s3"
+)
+
+const (
+	// MinSecretLength is the shortest accepted signing secret.
+	MinSecretLength = 32
+	// minSecretChars is how many different characters a secret needs, to
+	// catch placeholders like "xxxx...".
+	minSecretChars = 8
+	// minPolkaSecretLength is shorter because Polka issues the secret.
+	minPolkaSecretLength = 16
+)
+
+// FileEnv names the environment variable holding the config file path, for
+// when the -config flag isn't given.
+const FileEnv = "CHIRPY_CONFIG_FILE"
+
+const redacted = "[redacted]"
+
+type Config struct {
+	DBURL    string
+	Platform string
+	Addr     string
+	// AllowedOrigins may open websockets from a browser, besides the
+	// server's own origin.
+	AllowedOrigins []string
+
+	TokenSecret     string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+
+	// PolkaSecrets are all accepted while Polka rotates its signing key.
+	PolkaSecrets   []string
+	PolkaTolerance time.Duration
+
+	// MetricsToken is the bearer token Prometheus scrapes /metrics with.
+	// Empty turns the endpoint off.
+	MetricsToken string
+
+	RestoreWindow time.Duration
+	// DuplicateWindow is how long an author has to wait before posting the
+	// same text again. Zero turns the check off.
+	DuplicateWindow   time.Duration
+	ContentFilterFile string
+
+	Media Media
+
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	// DrainDelay is how long readiness fails before the server stops
+	// accepting connections; ShutdownTimeout bounds draining requests, and
+	// then separately stopping the workers.
+	DrainDelay      time.Duration
+	ShutdownTimeout time.Duration
+
+	LogLevel slog.Level
+}
+
+// Media says where uploads are stored.
+type Media struct {
+	Backend string
+	Dir     string
+	BaseURL string
+
+	S3Endpoint  string
+	S3Region    string
+	S3Bucket    string
+	S3AccessKey string
+	S3SecretKey string
+	S3PublicURL string
+}
+
+type setting struct {
+	name   string
+	usage  string
+	def    string
+	secret bool
+	apply  func(c *Config, value string) error
+}
+
+func (s setting) flagName() string {
+	return strings.ReplaceAll(strings.ToLower(s.name), "_", "-")
+}
+
+var settings = []setting{
+	{name: "DB_URL", usage: "Postgres connection URL", apply: func(c *Config, v string) error {
+		c.DBURL = v
+		return nil
+	}},
+	{name: "PLATFORM", usage: "dev or prod; dev enables the reset endpoint and plain HTTP webhooks", def: PlatformProd, apply: func(c *Config, v string) error {
+		c.Platform = v
+		return nil
+	}},
+	{name: "ADDR", usage: "address to listen on", def: ":8080", apply: func(c *Config, v string) error {
+		c.Addr = v
+		return nil
+	}},
+	{name: "ALLOWED_ORIGINS", usage: "comma-separated origins, like https://example.com, allowed to open websockets", apply: func(c *Config, v string) error {
+		c.AllowedOrigins = []string{}
+		for _, origin := range strings.Split(v, ",") {
+			origin = strings.TrimSpace(origin)
+			if origin == "" {
+				continue
+			}
+			u, err := url.Parse(origin)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" {
+				return fmt.Errorf("%q isn't an origin like https://example.com", origin)
+			}
+			c.AllowedOrigins = append(c.AllowedOrigins, strings.ToLower(u.Scheme+"://"+u.Host))
+		}
+		return nil
+	}},
+	{name: "LOG_LEVEL", usage: "debug, info, warn or error", def: "info", apply: func(c *Config, v string) error {
+		return c.LogLevel.UnmarshalText([]byte(v))
+	}},
+	{name: "TOKEN_SECRET", usage: "secret for signing access tokens", secret: true, apply: func(c *Config, v string) error {
+		c.TokenSecret = v
+		return nil
+	}},
+	{name: "ACCESS_TOKEN_TTL", usage: "access token lifetime", def: "1h", apply: duration(func(c *Config) *time.Duration { return &c.AccessTokenTTL })},
+	{name: "REFRESH_TOKEN_TTL", usage: "refresh token lifetime", def: "1440h", apply: duration(func(c *Config) *time.Duration { return &c.RefreshTokenTTL })},
+	{name: "POLKA_WEBHOOK_SECRETS", usage: "comma-separated Polka webhook signing secrets", secret: true, apply: func(c *Config, v string) error {
+		c.PolkaSecrets = []string{}
+		for _, secret := range strings.Split(v, ",") {
+			if secret = strings.TrimSpace(secret); secret != "" {
+				c.PolkaSecrets = append(c.PolkaSecrets, secret)
+			}
+		}
+		return nil
+	}},
+	// POLKA_KEY is the single secret from before signing was required.
+	{name: "POLKA_KEY", usage: "Polka webhook secret, if POLKA_WEBHOOK_SECRETS isn't set", secret: true, apply: func(c *Config, v string) error {
+		if len(c.PolkaSecrets) == 0 && v != "" {
+			c.PolkaSecrets = []string{v}
+		}
+		return nil
+	}},
+	{name: "POLKA_WEBHOOK_TOLERANCE", usage: "allowed clock difference for Polka webhooks", def: "5m", apply: duration(func(c *Config) *time.Duration { return &c.PolkaTolerance })},
+	{name: "METRICS_TOKEN", usage: "bearer token for scraping /metrics; empty disables the endpoint", secret: true, apply: func(c *Config, v string) error {
+		c.MetricsToken = v
+		return nil
+	}},
+	{name: "CHIRP_RESTORE_DAYS", usage: "days a deleted chirp can be restored", def: "30", apply: func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return errors.New("must be a whole number of days")
+		}
+		c.RestoreWindow = time.Duration(n) * 24 * time.Hour
+		return nil
+	}},
+	{name: "DUPLICATE_CHIRP_WINDOW", usage: "how long identical chirps are rejected; 0 disables", def: "24h", apply: duration(func(c *Config) *time.Duration { return &c.DuplicateWindow })},
+	{name: "CONTENT_FILTER_FILE", usage: "file of content filter rules", apply: func(c *Config, v string) error {
+		c.ContentFilterFile = v
+		return nil
+	}},
+	{name: "MEDIA_BACKEND", usage: "local or s3", def: MediaLocal, apply: func(c *Config, v string) error {
+		c.Media.Backend = v
+		return nil
+	}},
+	{name: "MEDIA_DIR", usage: "directory for local uploads", def: "uploads", apply: func(c *Config, v string) error {
+		c.Media.Dir = v
+		return nil
+	}},
+	{name: "MEDIA_BASE_URL", usage: "URL local uploads are served from", def: "/media", apply: func(c *Config, v string) error {
+		c.Media.BaseURL = v
+		return nil
+	}},
+	{name: "S3_ENDPOINT", usage: "S3 endpoint URL", apply: func(c *Config, v string) error {
+		c.Media.S3Endpoint = v
+		return nil
+	}},
+	{name: "S3_REGION", usage: "S3 region", apply: func(c *Config, v string) error {
+		c.Media.S3Region = v
+		return nil
+	}},
+	{name: "S3_BUCKET", usage: "S3 bucket", apply: func(c *Config, v string) error {
+		c.Media.S3Bucket = v
+		return nil
+	}},
+	{name: "S3_ACCESS_KEY", usage: "S3 access key", apply: func(c *Config, v string) error {
+		c.Media.S3AccessKey = v
+		return nil
+	}},
+	{name: "S3_SECRET_KEY", usage: "S3 secret key", secret: true, apply: func(c *Config, v string) error {
+		c.Media.S3SecretKey = v
+		return nil
+	}},
+	{name: "S3_PUBLIC_URL", usage: "URL S3 objects are served from", apply: func(c *Config, v string) error {
+		c.Media.S3PublicURL = v
+		return nil
+	}},
+	{name: "HTTP_READ_HEADER_TIMEOUT", usage: "time allowed to read request headers", def: "10s", apply: duration(func(c *Config) *time.Duration { return &c.ReadHeaderTimeout })},
+	{name: "HTTP_READ_TIMEOUT", usage: "time allowed to read a request", def: "1m", apply: duration(func(c *Config) *time.Duration { return &c.ReadTimeout })},
+	{name: "HTTP_WRITE_TIMEOUT", usage: "time allowed to write a response", def: "1m", apply: duration(func(c *Config) *time.Duration { return &c.WriteTimeout })},
+	{name: "HTTP_IDLE_TIMEOUT", usage: "how long idle connections are kept", def: "2m", apply: duration(func(c *Config) *time.Duration { return &c.IdleTimeout })},
+	{name: "SHUTDOWN_DRAIN_DELAY", usage: "how long readiness fails before shutdown", def: "5s", apply: duration(func(c *Config) *time.Duration { return &c.DrainDelay })},
+	{name: "SHUTDOWN_TIMEOUT", usage: "time allowed for requests, then again for workers, to finish on shutdown", def: "30s", apply: duration(func(c *Config) *time.Duration { return &c.ShutdownTimeout })},
+}
+
+func duration(field func(c *Config) *time.Duration) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			return errors.New("must be a duration like 30s or 1h")
+		}
+		*field(c) = d
+		return nil
+	}
+}
+
+// Load reads the config from the environment, the file named by -config or
+// CHIRPY_CONFIG_FILE, and args, then validates it.
+func Load(args []string) (Config, error) {
+	return load(args, os.LookupEnv, os.Stderr)
+}
+
+func load(args []string, lookupEnv func(string) (string, bool), output io.Writer) (Config, error) {
+	flags := flag.NewFlagSet("chirpy", flag.ContinueOnError)
+	flags.SetOutput(output)
+	file := flags.String("config", "", "config file of NAME=value lines; defaults to $"+FileEnv)
+	flagValues := map[string]*string{}
+	for _, s := range settings {
+		flagValues[s.name] = flags.String(s.flagName(), "", s.usage+" ($"+s.name+")")
+	}
+	err := flags.Parse(args)
+	if err != nil {
+		return Config{}, err
+	}
+	setFlags := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) { setFlags[f.Name] = true })
+
+	if !setFlags["config"] {
+		*file, _ = lookupEnv(FileEnv)
+	}
+	fileValues := map[string]string{}
+	if *file != "" {
+		fileValues, err = godotenv.Read(*file)
+		if err != nil {
+			return Config{}, fmt.Errorf("Error reading config file: %w", err)
+		}
+	}
+
+	c := Config{}
+	errs := []error{}
+	for _, s := range settings {
+		value := s.def
+		if v, ok := fileValues[s.name]; ok {
+			value = v
+		}
+		if v, ok := lookupEnv(s.name); ok {
+			value = v
+		}
+		if setFlags[s.flagName()] {
+			value = *flagValues[s.name]
+		}
+		if value == "" && s.def != "" {
+			value = s.def
+		}
+		if err := s.apply(&c, value); err != nil {
+			errs = append(errs, fmt.Errorf("Invalid %s: %w.", s.name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return Config{}, errors.Join(errs...)
+	}
+	return c, c.Validate()
+}
+
+// Validate checks that required settings are present and secrets are
+// strong enough, returning every problem found.
+func (c Config) Validate() error {
+	errs := []error{}
+	if c.DBURL == "" {
+		errs = append(errs, errors.New("DB_URL is required."))
+	}
+	if c.Platform != PlatformDev && c.Platform != PlatformProd {
+		errs = append(errs, fmt.Errorf("PLATFORM must be %s or %s.", PlatformDev, PlatformProd))
+	}
+	if err := checkSecret("TOKEN_SECRET", c.TokenSecret, MinSecretLength); err != nil {
+		errs = append(errs, err)
+	}
+	if len(c.PolkaSecrets) == 0 {
+		errs = append(errs, errors.New("POLKA_WEBHOOK_SECRETS or POLKA_KEY is required."))
+	}
+	for _, secret := range c.PolkaSecrets {
+		if err := checkSecret("POLKA_WEBHOOK_SECRETS", secret, minPolkaSecretLength); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if c.MetricsToken != "" {
+		if err := checkSecret("METRICS_TOKEN", c.MetricsToken, MinSecretLength); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for name, d := range map[string]time.Duration{"ACCESS_TOKEN_TTL": c.AccessTokenTTL, "REFRESH_TOKEN_TTL": c.RefreshTokenTTL, "POLKA_WEBHOOK_TOLERANCE": c.PolkaTolerance} {
+		if d <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be more than zero.", name))
+		}
+	}
+	if c.RefreshTokenTTL < c.AccessTokenTTL {
+		errs = append(errs, errors.New("REFRESH_TOKEN_TTL must be at least ACCESS_TOKEN_TTL."))
+	}
+	switch c.Media.Backend {
+	case MediaLocal:
+	case MediaS3:
+		if c.Media.S3Endpoint == "" || c.Media.S3Bucket == "" || c.Media.S3AccessKey == "" || c.Media.S3SecretKey == "" {
+			errs = append(errs, errors.New("S3_ENDPOINT, S3_BUCKET, S3_ACCESS_KEY and S3_SECRET_KEY are required for the s3 media backend."))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("MEDIA_BACKEND must be %s or %s.", MediaLocal, MediaS3))
+	}
+	return errors.Join(errs...)
+}
+
+func checkSecret(name, secret string, minLength int) error {
+	if secret == "" {
+		return fmt.Errorf("%s is required.", name)
+	}
+	if len(secret) < minLength {
+		return fmt.Errorf("%s must be at least %d characters.", name, minLength)
+	}
+	chars := map[rune]bool{}
+	for _, r := range secret {
+		chars[r] = true
+	}
+	if len(chars) < minSecretChars {
+		return fmt.Errorf("%s is too repetitive to be a real secret.", name)
+	}
+	return nil
+}
+
+// Redacted lists every setting as NAME=value, one per line, with secrets
+// and the database password hidden. It is meant for startup logs.
+func (c Config) Redacted() string {
+	values := map[string]string{
+		"DB_URL":                   redactURL(c.DBURL),
+		"PLATFORM":                 c.Platform,
+		"ADDR":                     c.Addr,
+		"ALLOWED_ORIGINS":          strings.Join(c.AllowedOrigins, ","),
+		"LOG_LEVEL":                c.LogLevel.String(),
+		"TOKEN_SECRET":             redact(c.TokenSecret),
+		"ACCESS_TOKEN_TTL":         c.AccessTokenTTL.String(),
+		"REFRESH_TOKEN_TTL":        c.RefreshTokenTTL.String(),
+		"POLKA_WEBHOOK_SECRETS":    redact(strings.Join(c.PolkaSecrets, ",")),
+		"POLKA_WEBHOOK_TOLERANCE":  c.PolkaTolerance.String(),
+		"METRICS_TOKEN":            redact(c.MetricsToken),
+		"CHIRP_RESTORE_DAYS":       strconv.Itoa(int(c.RestoreWindow / (24 * time.Hour))),
+		"DUPLICATE_CHIRP_WINDOW":   c.DuplicateWindow.String(),
+		"CONTENT_FILTER_FILE":      c.ContentFilterFile,
+		"MEDIA_BACKEND":            c.Media.Backend,
+		"MEDIA_DIR":                c.Media.Dir,
+		"MEDIA_BASE_URL":           c.Media.BaseURL,
+		"S3_ENDPOINT":              c.Media.S3Endpoint,
+		"S3_REGION":                c.Media.S3Region,
+		"S3_BUCKET":                c.Media.S3Bucket,
+		"S3_ACCESS_KEY":            c.Media.S3AccessKey,
+		"S3_SECRET_KEY":            redact(c.Media.S3SecretKey),
+		"S3_PUBLIC_URL":            c.Media.S3PublicURL,
+		"HTTP_READ_HEADER_TIMEOUT": c.ReadHeaderTimeout.String(),
+		"HTTP_READ_TIMEOUT":        c.ReadTimeout.String(),
+		"HTTP_WRITE_TIMEOUT":       c.WriteTimeout.String(),
+		"HTTP_IDLE_TIMEOUT":        c.IdleTimeout.String(),
+		"SHUTDOWN_DRAIN_DELAY":     c.DrainDelay.String(),
+		"SHUTDOWN_TIMEOUT":         c.ShutdownTimeout.String(),
+	}
+	b := strings.Builder{}
+	for _, s := range settings {
+		// POLKA_KEY is folded into POLKA_WEBHOOK_SECRETS.
+		value, ok := values[s.name]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(&b, "%s=%s\n", s.name, value)
+	}
+	return b.String()
+}
+
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return redacted
+}
+
+// sensitiveParams are connection parameters that hold secrets, or say where
+// to find them.
+var sensitiveParams = []string{"password", "sslpassword", "sslkey", "passfile"}
+
+// redactURL hides the password in a URL, whether it is in the userinfo or a
+// query parameter. Anything else, like a key=value connection string, is
+// hidden entirely.
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme == "" {
+		return redact(rawURL)
+	}
+	params := strings.Split(u.RawQuery, "&")
+	for i, param := range params {
+		key, _, _ := strings.Cut(param, "=")
+		if name, err := url.QueryUnescape(key); err != nil || slices.Contains(sensitiveParams, strings.ToLower(name)) {
+			// Redacted masks the userinfo password the same way.
+			params[i] = key + "=xxxxx"
+		}
+	}
+	u.RawQuery = strings.Join(params, "&")
+	return u.Redacted()
+}
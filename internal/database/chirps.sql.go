@@ -7,29 +7,32 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
 )
 
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, body_hash)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
+    $2,
+    $3
 )
-RETURNING id, created_at, updated_at, body, user_id
+RETURNING id, created_at, updated_at, body, user_id, deleted_at, body_hash, hidden_at
 `
 
 type CreateChirpParams struct {
-	Body   string
-	UserID uuid.UUID
+	Body     string
+	UserID   uuid.UUID
+	BodyHash sql.NullString
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID, arg.BodyHash)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -37,19 +40,13 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.DeletedAt,
+		&i.BodyHash,
+		&i.HiddenAt,
 	)
 	return i, err
 }
 
-const deleteChirp = `-- name: DeleteChirp :exec
-DELETE FROM chirps WHERE id = $1
-`
-
-func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
-	_, err := q.db.ExecContext(ctx, deleteChirp, id)
-	return err
-}
-
 const deleteChirps = `-- name: DeleteChirps :exec
 DELETE FROM chirps
 `
@@ -60,7 +57,7 @@ func (q *Queries) DeleteChirps(ctx context.Context) error {
 }
 
 const getChirp = `-- name: GetChirp :one
-SELECT id, created_at, updated_at, body, user_id FROM chirps WHERE id = $1
+SELECT id, created_at, updated_at, body, user_id, deleted_at, body_hash, hidden_at FROM chirps WHERE id = $1 AND deleted_at IS NULL AND hidden_at IS NULL
 `
 
 func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
@@ -72,16 +69,49 @@ func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.DeletedAt,
+		&i.BodyHash,
+		&i.HiddenAt,
+	)
+	return i, err
+}
+
+const getChirpForModeration = `-- name: GetChirpForModeration :one
+SELECT id, created_at, updated_at, body, user_id, deleted_at, body_hash, hidden_at FROM chirps WHERE id = $1
+`
+
+func (q *Queries) GetChirpForModeration(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getChirpForModeration, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.DeletedAt,
+		&i.BodyHash,
+		&i.HiddenAt,
 	)
 	return i, err
 }
 
 const getChirps = `-- name: GetChirps :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps ORDER BY created_at ASC
+SELECT id, created_at, updated_at, body, user_id, deleted_at, body_hash, hidden_at FROM chirps
+WHERE deleted_at IS NULL AND hidden_at IS NULL
+AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocks.blocker_id = $1 AND blocks.blocked_id = chirps.user_id)
+        OR (blocks.blocker_id = chirps.user_id AND blocks.blocked_id = $1)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM mutes WHERE mutes.muter_id = $1 AND mutes.muted_id = chirps.user_id
+)
+ORDER BY created_at ASC
 `
 
-func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirps)
+func (q *Queries) GetChirps(ctx context.Context, viewerID uuid.NullUUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirps, viewerID)
 	if err != nil {
 		return nil, err
 	}
@@ -95,6 +125,9 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.DeletedAt,
+			&i.BodyHash,
+			&i.HiddenAt,
 		); err != nil {
 			return nil, err
 		}
@@ -110,11 +143,97 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 }
 
 const getChirpsByUser = `-- name: GetChirpsByUser :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps WHERE user_id = $1 ORDER BY created_at ASC
+SELECT id, created_at, updated_at, body, user_id, deleted_at, body_hash, hidden_at FROM chirps
+WHERE user_id = $1
+AND deleted_at IS NULL AND hidden_at IS NULL
+AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocks.blocker_id = $2 AND blocks.blocked_id = chirps.user_id)
+        OR (blocks.blocker_id = chirps.user_id AND blocks.blocked_id = $2)
+)
+ORDER BY created_at ASC
+`
+
+type GetChirpsByUserParams struct {
+	UserID   uuid.UUID
+	ViewerID uuid.NullUUID
+}
+
+func (q *Queries) GetChirpsByUser(ctx context.Context, arg GetChirpsByUserParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByUser, arg.UserID, arg.ViewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.DeletedAt,
+			&i.BodyHash,
+			&i.HiddenAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const hasRecentDuplicate = `-- name: HasRecentDuplicate :one
+SELECT EXISTS (
+    SELECT 1 FROM chirps
+    WHERE user_id = $1 AND body_hash = $2 AND created_at > NOW() - $3::bigint * INTERVAL '1 second' AND deleted_at IS NULL
+)
+`
+
+type HasRecentDuplicateParams struct {
+	UserID        uuid.UUID
+	BodyHash      sql.NullString
+	WindowSeconds int64
+}
+
+func (q *Queries) HasRecentDuplicate(ctx context.Context, arg HasRecentDuplicateParams) (bool, error) {
+	row := q.db.QueryRowContext(ctx, hasRecentDuplicate, arg.UserID, arg.BodyHash, arg.WindowSeconds)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const hideChirp = `-- name: HideChirp :exec
+UPDATE chirps SET hidden_at = COALESCE(hidden_at, NOW())
+WHERE id = $1
+`
+
+func (q *Queries) HideChirp(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, hideChirp, id)
+	return err
+}
+
+const listDeletedChirps = `-- name: ListDeletedChirps :many
+SELECT id, created_at, updated_at, body, user_id, deleted_at, body_hash, hidden_at FROM chirps
+WHERE user_id = $1 AND deleted_at > NOW() - $2::bigint * INTERVAL '1 second' AND hidden_at IS NULL
+ORDER BY deleted_at DESC
 `
 
-func (q *Queries) GetChirpsByUser(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirpsByUser, userID)
+type ListDeletedChirpsParams struct {
+	UserID         uuid.UUID
+	RestoreSeconds int64
+}
+
+func (q *Queries) ListDeletedChirps(ctx context.Context, arg ListDeletedChirpsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listDeletedChirps, arg.UserID, arg.RestoreSeconds)
 	if err != nil {
 		return nil, err
 	}
@@ -128,6 +247,9 @@ func (q *Queries) GetChirpsByUser(ctx context.Context, userID uuid.UUID) ([]Chir
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.DeletedAt,
+			&i.BodyHash,
+			&i.HiddenAt,
 		); err != nil {
 			return nil, err
 		}
@@ -141,3 +263,110 @@ func (q *Queries) GetChirpsByUser(ctx context.Context, userID uuid.UUID) ([]Chir
 	}
 	return items, nil
 }
+
+const lockAuthorChirps = `-- name: LockAuthorChirps :exec
+SELECT pg_advisory_xact_lock(hashtext($1::text))
+`
+
+// Serializes chirp creation per author until the transaction ends, so two
+// identical chirps posted at once can't both pass the duplicate check.
+func (q *Queries) LockAuthorChirps(ctx context.Context, userID string) error {
+	_, err := q.db.ExecContext(ctx, lockAuthorChirps, userID)
+	return err
+}
+
+const purgeDeletedChirps = `-- name: PurgeDeletedChirps :many
+WITH purged AS (
+    DELETE FROM chirps WHERE deleted_at <= NOW() - $1::bigint * INTERVAL '1 second'
+    RETURNING id
+), purged_media AS (
+    DELETE FROM media USING purged WHERE media.chirp_id = purged.id
+    RETURNING media.chirp_id, media.storage_key, media.thumbnail_key
+)
+SELECT purged.id, purged_media.storage_key, purged_media.thumbnail_key
+FROM purged LEFT JOIN purged_media ON purged_media.chirp_id = purged.id
+`
+
+type PurgeDeletedChirpsRow struct {
+	ID           uuid.UUID
+	StorageKey   sql.NullString
+	ThumbnailKey sql.NullString
+}
+
+// Hard-deletes chirps past the restore window. Their media rows are deleted
+// here instead of by the cascade, in the same statement, so the stored files
+// can be removed too. Chirps without media come back with null keys.
+func (q *Queries) PurgeDeletedChirps(ctx context.Context, restoreSeconds int64) ([]PurgeDeletedChirpsRow, error) {
+	rows, err := q.db.QueryContext(ctx, purgeDeletedChirps, restoreSeconds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []PurgeDeletedChirpsRow
+	for rows.Next() {
+		var i PurgeDeletedChirpsRow
+		if err := rows.Scan(&i.ID, &i.StorageKey, &i.ThumbnailKey); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const removeChirp = `-- name: RemoveChirp :exec
+UPDATE chirps SET hidden_at = COALESCE(hidden_at, NOW()), deleted_at = COALESCE(deleted_at, NOW())
+WHERE id = $1
+`
+
+// Deleted by a moderator: hidden as well, so the author can't restore it.
+func (q *Queries) RemoveChirp(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, removeChirp, id)
+	return err
+}
+
+const restoreChirp = `-- name: RestoreChirp :one
+UPDATE chirps SET deleted_at = NULL
+WHERE id = $1 AND user_id = $2 AND deleted_at > NOW() - $3::bigint * INTERVAL '1 second' AND hidden_at IS NULL
+RETURNING id, created_at, updated_at, body, user_id, deleted_at, body_hash, hidden_at
+`
+
+type RestoreChirpParams struct {
+	ID             uuid.UUID
+	UserID         uuid.UUID
+	RestoreSeconds int64
+}
+
+func (q *Queries) RestoreChirp(ctx context.Context, arg RestoreChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, restoreChirp, arg.ID, arg.UserID, arg.RestoreSeconds)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.DeletedAt,
+		&i.BodyHash,
+		&i.HiddenAt,
+	)
+	return i, err
+}
+
+const softDeleteChirp = `-- name: SoftDeleteChirp :execrows
+UPDATE chirps SET deleted_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL
+`
+
+func (q *Queries) SoftDeleteChirp(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, softDeleteChirp, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,30 @@
+package dedupe
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"unicode"
+)
+
+// Normalize reduces a chirp body to the text that matters for spotting
+// reposts: case, punctuation, symbols and spacing are ignored, so
+// "Good morning!!" and "good   morning" match. A body with no letters or
+// digits, like "🎉🎉" or "!!!", only has its case and spacing ignored, so
+// different emoji don't all count as the same chirp.
+func Normalize(body string) string {
+	lower := strings.ToLower(body)
+	words := strings.FieldsFunc(lower, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	if len(words) == 0 {
+		words = strings.Fields(lower)
+	}
+	return strings.Join(words, " ")
+}
+
+// Hash returns the hex SHA-256 of the normalized body.
+func Hash(body string) string {
+	sum := sha256.Sum256([]byte(Normalize(body)))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,33 @@
+package dedupe
+
+import "testing"
+
+// TestNormalize tests that case, punctuation and spacing are ignored
+func TestNormalize(t *testing.T) {
+	cases := map[string]string{
+		"Good morning!!":          "good morning",
+		"  good\tmorning ":        "good morning",
+		"GOOD... morning :)":      "good morning",
+		"café au lait, s'il vous": "café au lait s il vous",
+		"":                        "",
+		" 🎉  🎉 ":                  "🎉 🎉",
+		"!!!":                     "!!!",
+	}
+	for input, want := range cases {
+		if got := Normalize(input); got != want {
+			t.Fatalf("Normalize(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestHash(t *testing.T) {
+	if Hash("Good morning!") != Hash("good morning") {
+		t.Fatal("Equivalent bodies hash differently.")
+	}
+	if Hash("good morning") == Hash("good evening") {
+		t.Fatal("Different bodies hash the same.")
+	}
+	if Hash("🎉🎉") == Hash("🔥") || Hash("!!!") == Hash("???") {
+		t.Fatal("Bodies without words hash the same.")
+	}
+}
@@ -0,0 +1,55 @@
+// Package entitlements maps subscription plans to what they unlock, so
+// handlers ask about a capability instead of checking the plan themselves.
+package entitlements
+
+import "slices"
+
+type Plan string
+
+const (
+	PlanFree      Plan = "free"
+	PlanChirpyRed Plan = "chirpy_red"
+)
+
+// Capabilities a plan can include.
+const (
+	// ChirpLong allows chirps past the standard length limit.
+	ChirpLong = "chirp.long"
+	// ChirpSchedule allows drafts with a publish time.
+	ChirpSchedule = "chirp.schedule"
+)
+
+// Entitlements is what a user's plan allows.
+type Entitlements struct {
+	Plan          Plan     `json:"plan"`
+	Capabilities  []string `json:"capabilities"`
+	MediaPerChirp int      `json:"media_per_chirp"`
+}
+
+var plans = map[Plan]Entitlements{
+	PlanFree: {
+		Plan:          PlanFree,
+		Capabilities:  []string{ChirpSchedule},
+		MediaPerChirp: 4,
+	},
+	PlanChirpyRed: {
+		Plan:          PlanChirpyRed,
+		Capabilities:  []string{ChirpLong, ChirpSchedule},
+		MediaPerChirp: 8,
+	},
+}
+
+// For returns the entitlements of a plan. Unknown plans get the free plan.
+func For(plan Plan) Entitlements {
+	e, ok := plans[plan]
+	if !ok {
+		e = plans[PlanFree]
+	}
+	e.Capabilities = slices.Clone(e.Capabilities)
+	return e
+}
+
+// Can reports whether the plan includes the capability.
+func (e Entitlements) Can(capability string) bool {
+	return slices.Contains(e.Capabilities, capability)
+}
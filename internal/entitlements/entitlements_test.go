@@ -0,0 +1,35 @@
+package entitlements
+
+import "testing"
+
+// TestFor tests that each plan unlocks what it should
+func TestFor(t *testing.T) {
+	free := For(PlanFree)
+	if free.Can(ChirpLong) {
+		t.Fatalf("Free plan can post long chirps")
+	}
+	if !free.Can(ChirpSchedule) {
+		t.Fatalf("Free plan can't schedule chirps")
+	}
+	red := For(PlanChirpyRed)
+	if !red.Can(ChirpLong) || !red.Can(ChirpSchedule) {
+		t.Fatalf("Chirpy Red capabilities = %v", red.Capabilities)
+	}
+	if red.MediaPerChirp <= free.MediaPerChirp {
+		t.Fatalf("Chirpy Red media per chirp = %d, free = %d", red.MediaPerChirp, free.MediaPerChirp)
+	}
+}
+
+func TestForUnknownPlan(t *testing.T) {
+	if got := For("platinum"); got.Plan != PlanFree {
+		t.Fatalf("For(platinum).Plan = %s, want %s", got.Plan, PlanFree)
+	}
+}
+
+func TestForCopiesCapabilities(t *testing.T) {
+	e := For(PlanFree)
+	e.Capabilities[0] = ChirpLong
+	if For(PlanFree).Can(ChirpLong) {
+		t.Fatalf("Changing returned capabilities changed the plan")
+	}
+}
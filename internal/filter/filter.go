@@ -0,0 +1,260 @@
+package filter
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+type Action string
+
+const (
+	// ActionMask replaces the matched words with asterisks.
+	ActionMask Action = "mask"
+	// ActionReject refuses the whole chirp.
+	ActionReject Action = "reject"
+	// ActionFlag lets the chirp through but queues it for review.
+	ActionFlag Action = "flag"
+)
+
+const maskText = "****"
+
+var ErrInvalidAction = errors.New("Action must be mask, reject or flag.")
+
+func ParseAction(s string) (Action, error) {
+	switch a := Action(strings.ToLower(strings.TrimSpace(s))); a {
+	case ActionMask, ActionReject, ActionFlag:
+		return a, nil
+	}
+	return "", ErrInvalidAction
+}
+
+// Rule matches a word or phrase. Terms are compared after the same
+// normalization as chirps, so "Kerfuffle" also catches "ｋｅｒｆｕｆｆｌｅ".
+type Rule struct {
+	Term   string
+	Action Action
+}
+
+// Result is the outcome of filtering one chirp.
+type Result struct {
+	// Body has the masked words replaced.
+	Body     string
+	Rejected bool
+	Flagged  bool
+	// Matches lists the rule terms that matched, once each.
+	Matches []string
+}
+
+type compiledRule struct {
+	Rule
+	tokens []string
+}
+
+// Engine applies a set of rules. It's safe for concurrent use, and the rules
+// can be swapped at runtime.
+type Engine struct {
+	mu sync.RWMutex
+	// byFirst indexes rules by their first token.
+	byFirst map[string][]compiledRule
+}
+
+func NewEngine(rules []Rule) *Engine {
+	e := &Engine{}
+	e.SetRules(rules)
+	return e
+}
+
+func (e *Engine) SetRules(rules []Rule) {
+	byFirst := map[string][]compiledRule{}
+	for _, rule := range rules {
+		tokens := []string{}
+		for _, t := range tokenize(rule.Term) {
+			tokens = append(tokens, t.text)
+		}
+		if len(tokens) == 0 {
+			continue
+		}
+		byFirst[tokens[0]] = append(byFirst[tokens[0]], compiledRule{Rule: rule, tokens: tokens})
+	}
+	e.mu.Lock()
+	e.byFirst = byFirst
+	e.mu.Unlock()
+}
+
+func (e *Engine) Apply(text string) Result {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	tokens := tokenize(text)
+	result := Result{}
+	seen := map[string]bool{}
+	// masked holds the byte ranges to replace, in order and not overlapping.
+	masked := [][2]int{}
+	for i := 0; i < len(tokens); i++ {
+		rule, ok := e.match(tokens[i:])
+		if !ok {
+			continue
+		}
+		if !seen[rule.Term] {
+			seen[rule.Term] = true
+			result.Matches = append(result.Matches, rule.Term)
+		}
+		switch rule.Action {
+		case ActionReject:
+			result.Rejected = true
+		case ActionFlag:
+			result.Flagged = true
+		case ActionMask:
+			last := i + len(rule.tokens) - 1
+			masked = append(masked, [2]int{tokens[i].start, tokens[last].end})
+			i = last
+		}
+	}
+
+	b := strings.Builder{}
+	prev := 0
+	for _, span := range masked {
+		b.WriteString(text[prev:span[0]])
+		b.WriteString(maskText)
+		prev = span[1]
+	}
+	b.WriteString(text[prev:])
+	result.Body = b.String()
+	return result
+}
+
+// match returns the longest rule starting at the first token. Among rules of
+// the same length, reject wins over flag, and flag over mask.
+func (e *Engine) match(tokens []token) (compiledRule, bool) {
+	best, found := compiledRule{}, false
+	for _, rule := range e.byFirst[tokens[0].text] {
+		if len(rule.tokens) > len(tokens) {
+			continue
+		}
+		matched := true
+		for j, t := range rule.tokens[1:] {
+			if tokens[j+1].text != t {
+				matched = false
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+		if !found || len(rule.tokens) > len(best.tokens) ||
+			(len(rule.tokens) == len(best.tokens) && severity[rule.Action] > severity[best.Action]) {
+			best, found = rule, true
+		}
+	}
+	return best, found
+}
+
+var severity = map[Action]int{ActionMask: 1, ActionFlag: 2, ActionReject: 3}
+
+// ParseRules reads rules from a word list, one "action term" per line.
+// Blank lines and lines starting with # are skipped.
+func ParseRules(r io.Reader) ([]Rule, error) {
+	rules := []Rule{}
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		action, term, ok := strings.Cut(text, " ")
+		term = strings.TrimSpace(term)
+		if !ok || term == "" {
+			return nil, fmt.Errorf("line %d: expected \"action term\"", line)
+		}
+		a, err := ParseAction(action)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		rules = append(rules, Rule{Term: term, Action: a})
+	}
+	return rules, scanner.Err()
+}
+
+type token struct {
+	text       string
+	start, end int
+}
+
+// tokenize splits text into normalized words, keeping each word's byte range
+// in the original text. Anything that isn't a letter or digit after folding
+// separates words, so punctuation can't hide a word, while invisible
+// characters and combining marks are dropped so they can't split one.
+func tokenize(text string) []token {
+	tokens := []token{}
+	current := strings.Builder{}
+	start := -1
+	flush := func(end int) {
+		if start >= 0 {
+			tokens = append(tokens, token{text: current.String(), start: start, end: end})
+			current.Reset()
+			start = -1
+		}
+	}
+	for i, r := range text {
+		if unicode.In(r, unicode.Mn, unicode.Cf) {
+			continue
+		}
+		folded := fold(r)
+		if folded == "" {
+			flush(i)
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+		current.WriteString(folded)
+	}
+	flush(len(text))
+	return tokens
+}
+
+// fold maps a rune to its lowercase base letters: compatibility forms like
+// fullwidth and ligatures are decomposed, accents removed, and look-alikes
+// from other scripts or leetspeak replaced. It returns "" for separators.
+func fold(r rune) string {
+	b := strings.Builder{}
+	for _, c := range norm.NFKD.String(string(r)) {
+		if unicode.Is(unicode.Mn, c) {
+			continue
+		}
+		if mapped, ok := confusables[c]; ok {
+			c = mapped
+		}
+		c = unicode.ToLower(c)
+		if !unicode.IsLetter(c) && !unicode.IsNumber(c) {
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// confusables maps characters that are commonly swapped in to dodge filters
+// onto the Latin letters they resemble.
+var confusables = map[rune]rune{
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'е': 'e', 'ё': 'e', 'к': 'k', 'м': 'm', 'н': 'h', 'о': 'o', 'р': 'p',
+	'с': 'c', 'т': 't', 'у': 'y', 'х': 'x', 'і': 'i', 'ј': 'j', 'ѕ': 's', 'һ': 'h', 'ԁ': 'd',
+	'А': 'a', 'В': 'b', 'Е': 'e', 'К': 'k', 'М': 'm', 'Н': 'h', 'О': 'o', 'Р': 'p', 'С': 'c',
+	'Т': 't', 'У': 'y', 'Х': 'x', 'І': 'i', 'Ј': 'j', 'Ѕ': 's',
+	// Greek
+	'α': 'a', 'β': 'b', 'ε': 'e', 'η': 'n', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o', 'ρ': 'p',
+	'τ': 't', 'υ': 'u', 'χ': 'x', 'Α': 'a', 'Β': 'b', 'Ε': 'e', 'Η': 'h', 'Ι': 'i', 'Κ': 'k',
+	'Μ': 'm', 'Ν': 'n', 'Ο': 'o', 'Ρ': 'p', 'Τ': 't', 'Υ': 'y', 'Χ': 'x', 'Ζ': 'z',
+	// Leetspeak
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '@': 'a', '$': 's',
+}
@@ -0,0 +1,70 @@
+package filter
+
+import (
+	"strings"
+	"testing"
+)
+
+var testRules = []Rule{
+	{Term: "kerfuffle", Action: ActionMask},
+	{Term: "sharbert", Action: ActionMask},
+	{Term: "fornax", Action: ActionMask},
+	{Term: "buy followers", Action: ActionReject},
+	{Term: "crypto", Action: ActionFlag},
+}
+
+// TestApplyMasks tests that masked words are caught through punctuation,
+// case, accents, fullwidth forms, look-alikes and invisible characters
+func TestApplyMasks(t *testing.T) {
+	engine := NewEngine(testRules)
+	cases := map[string]string{
+		"This is a kerfuffle opinion": "This is a **** opinion",
+		"what a kerfuffle!":           "what a ****!",
+		"KERFUFFLE, Sharbert.":        "****, ****.",
+		"kérfüffle":                   "****",
+		"ｋｅｒｆｕｆｆｌｅ":                   "****",
+		"kеrfuffle":                   "****", // Cyrillic е
+		"k3rfuffl3":                   "****",
+		"ker\u200bfuffle":             "****",
+		"kerfuffles":                  "kerfuffles",
+		"hello world":                 "hello world",
+	}
+	for input, want := range cases {
+		result := engine.Apply(input)
+		if result.Body != want {
+			t.Fatalf("Apply(%q) = %q, want %q", input, result.Body, want)
+		}
+		if result.Rejected || result.Flagged {
+			t.Fatalf("Apply(%q) unexpectedly rejected or flagged", input)
+		}
+	}
+}
+
+func TestApplyActions(t *testing.T) {
+	engine := NewEngine(testRules)
+	result := engine.Apply("Want to BUY   followers? DM me")
+	if !result.Rejected || len(result.Matches) != 1 || result.Matches[0] != "buy followers" {
+		t.Fatalf("Expected phrase to reject, got %+v", result)
+	}
+	result = engine.Apply("Thoughts on crypto?")
+	if !result.Flagged || result.Rejected || result.Body != "Thoughts on crypto?" {
+		t.Fatalf("Expected flag without changes, got %+v", result)
+	}
+	engine.SetRules(nil)
+	if result := engine.Apply("kerfuffle"); result.Body != "kerfuffle" || len(result.Matches) != 0 {
+		t.Fatalf("Rules not replaced, got %+v", result)
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules(strings.NewReader("# comment\n\nmask kerfuffle\nREJECT buy followers\n"))
+	if err != nil {
+		t.Fatalf("Error parsing rules: %s", err)
+	}
+	if len(rules) != 2 || rules[1] != (Rule{Term: "buy followers", Action: ActionReject}) {
+		t.Fatalf("Unexpected rules: %+v", rules)
+	}
+	if _, err := ParseRules(strings.NewReader("delete kerfuffle")); err == nil {
+		t.Fatal("Expected error for unknown action.")
+	}
+}
@@ -0,0 +1,310 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/webp"
+)
+
+const (
+	MaxUploadSize = 5 << 20
+	// MaxPixels guards against small files that decode to huge images.
+	MaxPixels = 40_000_000
+	// MaxGIFPixels caps the pixels across all frames of an animation, since
+	// every frame is decoded to strip metadata.
+	MaxGIFPixels  = 100_000_000
+	ThumbnailSize = 320
+)
+
+var (
+	ErrUnsupportedType = errors.New("Image must be JPEG, PNG, GIF or WebP.")
+	ErrTooLarge        = errors.New("Image dimensions are too large.")
+)
+
+// Image is an upload that has been validated and cleaned of metadata.
+type Image struct {
+	ContentType   string
+	Extension     string
+	Data          []byte
+	Width         int
+	Height        int
+	Thumbnail     []byte
+	ThumbnailType string
+}
+
+// Process sniffs the content type of an upload, checks that it decodes,
+// strips EXIF and other metadata, and renders a thumbnail.
+func Process(data []byte) (Image, error) {
+	img := Image{ContentType: http.DetectContentType(data)}
+	var decodeConfig func([]byte) (image.Config, error)
+	var decode func([]byte) (image.Image, error)
+	var strip func([]byte) ([]byte, error)
+	switch img.ContentType {
+	case "image/jpeg":
+		img.Extension = "jpg"
+		decodeConfig = func(b []byte) (image.Config, error) { return jpeg.DecodeConfig(bytes.NewReader(b)) }
+		decode = func(b []byte) (image.Image, error) { return jpeg.Decode(bytes.NewReader(b)) }
+		strip = stripJPEG
+	case "image/png":
+		img.Extension = "png"
+		decodeConfig = func(b []byte) (image.Config, error) { return png.DecodeConfig(bytes.NewReader(b)) }
+		decode = func(b []byte) (image.Image, error) { return png.Decode(bytes.NewReader(b)) }
+		strip = stripPNG
+	case "image/gif":
+		img.Extension = "gif"
+		decodeConfig = func(b []byte) (image.Config, error) { return gif.DecodeConfig(bytes.NewReader(b)) }
+		decode = func(b []byte) (image.Image, error) { return gif.Decode(bytes.NewReader(b)) }
+		strip = stripGIF
+	case "image/webp":
+		img.Extension = "webp"
+		decodeConfig = func(b []byte) (image.Config, error) { return webp.DecodeConfig(bytes.NewReader(b)) }
+		decode = func(b []byte) (image.Image, error) { return webp.Decode(bytes.NewReader(b)) }
+		strip = stripWebP
+	default:
+		return Image{}, ErrUnsupportedType
+	}
+
+	config, err := decodeConfig(data)
+	if err != nil {
+		return Image{}, err
+	}
+	pixels := int64(config.Width) * int64(config.Height)
+	if pixels > MaxPixels {
+		return Image{}, ErrTooLarge
+	}
+	if img.ContentType == "image/gif" {
+		frames, err := countGIFFrames(data)
+		if err != nil {
+			return Image{}, err
+		}
+		if int64(frames)*pixels > MaxGIFPixels {
+			return Image{}, ErrTooLarge
+		}
+	}
+	decoded, err := decode(data)
+	if err != nil {
+		return Image{}, err
+	}
+	img.Width, img.Height = config.Width, config.Height
+
+	img.Data, err = strip(data)
+	if err != nil {
+		return Image{}, err
+	}
+	img.Thumbnail, img.ThumbnailType, err = thumbnail(decoded, img.ContentType == "image/jpeg")
+	if err != nil {
+		return Image{}, err
+	}
+	return img, nil
+}
+
+// thumbnail scales the image to fit in a ThumbnailSize square. Photos stay
+// JPEG, everything else becomes PNG to keep transparency.
+func thumbnail(src image.Image, photo bool) ([]byte, string, error) {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > ThumbnailSize || height > ThumbnailSize {
+		if width >= height {
+			width, height = ThumbnailSize, max(1, height*ThumbnailSize/width)
+		} else {
+			width, height = max(1, width*ThumbnailSize/height), ThumbnailSize
+		}
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Src, nil)
+
+	buf := bytes.Buffer{}
+	if photo {
+		err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 80})
+		return buf.Bytes(), "image/jpeg", err
+	}
+	err := png.Encode(&buf, dst)
+	return buf.Bytes(), "image/png", err
+}
+
+var errMalformed = errors.New("Malformed image.")
+
+// stripJPEG drops the EXIF/XMP (APP1), IPTC (APP13) and comment segments
+// before the image data, leaving the pixels untouched.
+func stripJPEG(data []byte) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, errMalformed
+	}
+	out := bytes.Buffer{}
+	out.Write(data[:2])
+	i := 2
+	for i < len(data) {
+		if data[i] != 0xFF {
+			return nil, errMalformed
+		}
+		// Runs of 0xFF are fill bytes.
+		for i+1 < len(data) && data[i+1] == 0xFF {
+			i++
+		}
+		if i+1 >= len(data) {
+			return nil, errMalformed
+		}
+		marker := data[i+1]
+		// Start of scan: the rest is entropy-coded data.
+		if marker == 0xDA {
+			out.Write(data[i:])
+			return out.Bytes(), nil
+		}
+		if i+4 > len(data) {
+			return nil, errMalformed
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:i+4]))
+		if end > len(data) {
+			return nil, errMalformed
+		}
+		if marker != 0xE1 && marker != 0xED && marker != 0xFE {
+			out.Write(data[i:end])
+		}
+		i = end
+	}
+	return nil, errMalformed
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// stripPNG drops the EXIF, text and timestamp chunks.
+func stripPNG(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, errMalformed
+	}
+	dropped := map[string]bool{"eXIf": true, "tEXt": true, "zTXt": true, "iTXt": true, "tIME": true}
+	out := bytes.Buffer{}
+	out.Write(pngSignature)
+	i := len(pngSignature)
+	for i < len(data) {
+		if i+8 > len(data) {
+			return nil, errMalformed
+		}
+		length := int(binary.BigEndian.Uint32(data[i : i+4]))
+		chunkType := string(data[i+4 : i+8])
+		end := i + 12 + length
+		if length < 0 || end > len(data) {
+			return nil, errMalformed
+		}
+		if !dropped[chunkType] {
+			out.Write(data[i:end])
+		}
+		i = end
+		if chunkType == "IEND" {
+			break
+		}
+	}
+	return out.Bytes(), nil
+}
+
+// stripGIF re-encodes every frame, which drops comments and application
+// extensions such as XMP while keeping the animation and loop count.
+func stripGIF(data []byte) ([]byte, error) {
+	decoded, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	buf := bytes.Buffer{}
+	err = gif.EncodeAll(&buf, decoded)
+	return buf.Bytes(), err
+}
+
+// countGIFFrames walks the GIF block structure to count image descriptors
+// without decoding any pixels.
+func countGIFFrames(data []byte) (int, error) {
+	if len(data) < 13 || (string(data[:6]) != "GIF87a" && string(data[:6]) != "GIF89a") {
+		return 0, errMalformed
+	}
+	i := 13
+	if data[10]&0x80 != 0 {
+		i += 3 << (data[10]&0x07 + 1)
+	}
+	// skipSubBlocks returns the index after a run of data sub-blocks.
+	skipSubBlocks := func(i int) (int, error) {
+		for {
+			if i >= len(data) {
+				return 0, errMalformed
+			}
+			size := int(data[i])
+			i++
+			if size == 0 {
+				return i, nil
+			}
+			i += size
+		}
+	}
+	frames := 0
+	var err error
+	for i < len(data) {
+		switch data[i] {
+		case 0x21: // Extension: label, then sub-blocks.
+			i, err = skipSubBlocks(i + 2)
+			if err != nil {
+				return 0, err
+			}
+		case 0x2C: // Image descriptor, local color table, LZW code size, data.
+			if i+10 > len(data) {
+				return 0, errMalformed
+			}
+			flags := data[i+9]
+			i += 10
+			if flags&0x80 != 0 {
+				i += 3 << (flags&0x07 + 1)
+			}
+			i, err = skipSubBlocks(i + 1)
+			if err != nil {
+				return 0, err
+			}
+			frames++
+		case 0x3B: // Trailer.
+			return frames, nil
+		default:
+			return 0, errMalformed
+		}
+	}
+	return frames, nil
+}
+
+// stripWebP drops the EXIF and XMP chunks from the RIFF container and clears
+// their flags in the extended header.
+func stripWebP(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, errMalformed
+	}
+	chunks := bytes.Buffer{}
+	i := 12
+	for i+8 <= len(data) {
+		fourCC := string(data[i : i+4])
+		size := int(binary.LittleEndian.Uint32(data[i+4 : i+8]))
+		end := i + 8 + size + size%2
+		if size < 0 || end > len(data) {
+			return nil, errMalformed
+		}
+		switch fourCC {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := bytes.Clone(data[i:end])
+			if size > 0 {
+				chunk[8] &^= 0x08 | 0x04
+			}
+			chunks.Write(chunk)
+		default:
+			chunks.Write(data[i:end])
+		}
+		i = end
+	}
+	out := bytes.Buffer{}
+	out.WriteString("RIFF")
+	binary.Write(&out, binary.LittleEndian, uint32(4+chunks.Len()))
+	out.WriteString("WEBP")
+	out.Write(chunks.Bytes())
+	return out.Bytes(), nil
+}
@@ -0,0 +1,148 @@
+package media
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func testImage(width, height int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 100, A: 255})
+		}
+	}
+	return img
+}
+
+// TestProcessJPEG tests that EXIF is stripped and a thumbnail is made
+func TestProcessJPEG(t *testing.T) {
+	buf := bytes.Buffer{}
+	if err := jpeg.Encode(&buf, testImage(640, 480), nil); err != nil {
+		t.Fatalf("Error encoding JPEG: %s", err)
+	}
+	exif := append([]byte("Exif\x00\x00"), []byte("GPS secret")...)
+	segment := append([]byte{0xFF, 0xE1, 0, 0}, exif...)
+	binary.BigEndian.PutUint16(segment[2:4], uint16(len(exif)+2))
+	data := append(append([]byte{0xFF, 0xD8}, segment...), buf.Bytes()[2:]...)
+
+	img, err := Process(data)
+	if err != nil {
+		t.Fatalf("Error processing JPEG: %s", err)
+	}
+	if img.ContentType != "image/jpeg" || img.Width != 640 || img.Height != 480 {
+		t.Fatalf("Unexpected image: %s %dx%d", img.ContentType, img.Width, img.Height)
+	}
+	if bytes.Contains(img.Data, []byte("GPS secret")) {
+		t.Fatal("EXIF not stripped.")
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(img.Data)); err != nil {
+		t.Fatalf("Stripped JPEG doesn't decode: %s", err)
+	}
+	thumb, err := jpeg.DecodeConfig(bytes.NewReader(img.Thumbnail))
+	if err != nil {
+		t.Fatalf("Error decoding thumbnail: %s", err)
+	}
+	if thumb.Width != ThumbnailSize || thumb.Height != 240 {
+		t.Fatalf("Unexpected thumbnail size: %dx%d", thumb.Width, thumb.Height)
+	}
+}
+
+func TestProcessPNG(t *testing.T) {
+	buf := bytes.Buffer{}
+	if err := png.Encode(&buf, testImage(10, 20)); err != nil {
+		t.Fatalf("Error encoding PNG: %s", err)
+	}
+	// Insert a tEXt chunk after IHDR, which is 8+25 bytes in.
+	text := []byte("Comment\x00GPS secret")
+	chunk := make([]byte, 4, 12+len(text))
+	binary.BigEndian.PutUint32(chunk, uint32(len(text)))
+	chunk = append(append(chunk, "tEXt"...), text...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+	original := buf.Bytes()
+	data := append(append(append([]byte{}, original[:33]...), chunk...), original[33:]...)
+
+	img, err := Process(data)
+	if err != nil {
+		t.Fatalf("Error processing PNG: %s", err)
+	}
+	if bytes.Contains(img.Data, []byte("GPS secret")) {
+		t.Fatal("Text chunk not stripped.")
+	}
+	if _, err := png.Decode(bytes.NewReader(img.Data)); err != nil {
+		t.Fatalf("Stripped PNG doesn't decode: %s", err)
+	}
+	if img.ThumbnailType != "image/png" {
+		t.Fatalf("Unexpected thumbnail type: %s", img.ThumbnailType)
+	}
+}
+
+func TestProcessWebP(t *testing.T) {
+	// A 1x1 lossless WebP.
+	data, err := base64.StdEncoding.DecodeString("UklGRhoAAABXRUJQVlA4TA0AAAAvAAAAEAcQERGIiP4HAA==")
+	if err != nil {
+		t.Fatalf("Error decoding fixture: %s", err)
+	}
+	exif := []byte("EXIF\x0a\x00\x00\x00GPS secret")
+	data = append(data, exif...)
+	binary.LittleEndian.PutUint32(data[4:8], uint32(len(data)-8))
+
+	img, err := Process(data)
+	if err != nil {
+		t.Fatalf("Error processing WebP: %s", err)
+	}
+	if img.ContentType != "image/webp" || img.Width != 1 || img.Height != 1 {
+		t.Fatalf("Unexpected image: %s %dx%d", img.ContentType, img.Width, img.Height)
+	}
+	if bytes.Contains(img.Data, []byte("GPS secret")) {
+		t.Fatal("EXIF chunk not stripped.")
+	}
+	if int(binary.LittleEndian.Uint32(img.Data[4:8])) != len(img.Data)-8 {
+		t.Fatal("RIFF size not updated.")
+	}
+}
+
+func TestProcessRejectsOtherTypes(t *testing.T) {
+	if _, err := Process([]byte("<html><body>hello</body></html>")); err != ErrUnsupportedType {
+		t.Fatalf("Expected unsupported type, got %v", err)
+	}
+}
+
+// TestProcessRejectsLargeAnimations tests that frames count towards the pixel
+// limit before the GIF is decoded
+func TestProcessRejectsLargeAnimations(t *testing.T) {
+	anim := &gif.GIF{Config: image.Config{Width: 5000, Height: 5000, ColorModel: color.Palette{color.Black, color.White}}}
+	for range 5 {
+		anim.Image = append(anim.Image, image.NewPaletted(image.Rect(0, 0, 1, 1), color.Palette{color.Black, color.White}))
+		anim.Delay = append(anim.Delay, 10)
+	}
+	buf := bytes.Buffer{}
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		t.Fatalf("Error encoding GIF: %s", err)
+	}
+	frames, err := countGIFFrames(buf.Bytes())
+	if err != nil || frames != 5 {
+		t.Fatalf("Unexpected frame count: %d %v", frames, err)
+	}
+	if _, err := Process(buf.Bytes()); err != ErrTooLarge {
+		t.Fatalf("Expected ErrTooLarge, got %v", err)
+	}
+
+	anim.Image, anim.Delay = anim.Image[:1], anim.Delay[:1]
+	anim.Config.Width, anim.Config.Height = 200, 100
+	buf.Reset()
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		t.Fatalf("Error encoding GIF: %s", err)
+	}
+	if _, err := Process(buf.Bytes()); err != nil {
+		t.Fatalf("Error processing GIF: %s", err)
+	}
+}
@@ -0,0 +1,115 @@
+package notify
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/curtisbraxdale/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+type Type string
+
+const (
+	TypeLike      Type = "like"
+	TypeReply     Type = "reply"
+	TypeMention   Type = "mention"
+	TypeFollow    Type = "follow"
+	TypeChirpyRed Type = "chirpy_red"
+	TypeWarning   Type = "warning"
+)
+
+// Event is something a user should hear about. Actor and ChirpID are optional
+// depending on the type.
+type Event struct {
+	Recipient uuid.UUID
+	Type      Type
+	Actor     uuid.NullUUID
+	ChirpID   uuid.NullUUID
+}
+
+// Service is the single entry point for creating notifications, so handlers
+// don't write notification rows themselves.
+type Service struct {
+	queries  *database.Queries
+	onNotify func(context.Context, database.Notification)
+}
+
+// NewService creates the service. onNotify, if not nil, is called with every
+// notification after it is stored, for real-time delivery.
+func NewService(queries *database.Queries, onNotify func(context.Context, database.Notification)) *Service {
+	return &Service{queries: queries, onNotify: onNotify}
+}
+
+// Notify records an event for its recipient. Events from the recipient
+// themselves, or from users they block or mute, are dropped. Grouped types fold
+// into the recipient's existing unread notification for the same group.
+func (s *Service) Notify(ctx context.Context, event Event) error {
+	if event.Actor.Valid {
+		if event.Actor.UUID == event.Recipient {
+			return nil
+		}
+		blocked, err := s.queries.HasBlock(ctx, database.HasBlockParams{BlockerID: event.Recipient, BlockedID: event.Actor.UUID})
+		if err != nil {
+			return err
+		}
+		muted, err := s.queries.HasMute(ctx, database.HasMuteParams{MuterID: event.Recipient, MutedID: event.Actor.UUID})
+		if err != nil {
+			return err
+		}
+		if blocked || muted {
+			return nil
+		}
+	}
+	params := database.CreateNotificationParams{
+		UserID:   event.Recipient,
+		Type:     string(event.Type),
+		ActorID:  event.Actor,
+		ChirpID:  event.ChirpID,
+		GroupKey: groupKey(event),
+	}
+	notification, err := s.queries.CreateNotification(ctx, params)
+	if err != nil {
+		return err
+	}
+	if s.onNotify != nil {
+		s.onNotify(ctx, notification)
+	}
+	return nil
+}
+
+// groupKey decides which events collapse together: likes per chirp and all
+// follows. Replies, mentions and upgrades are always shown on their own.
+func groupKey(event Event) sql.NullString {
+	switch event.Type {
+	case TypeLike:
+		return sql.NullString{String: fmt.Sprintf("like:%s", event.ChirpID.UUID), Valid: true}
+	case TypeFollow:
+		return sql.NullString{String: "follow", Valid: true}
+	}
+	return sql.NullString{}
+}
+
+// Message renders the text shown for a notification with count actors.
+func Message(notificationType Type, count int32) string {
+	who := "Someone"
+	if count > 1 {
+		who = fmt.Sprintf("%d people", count)
+	}
+	switch notificationType {
+	case TypeLike:
+		return who + " liked your chirp"
+	case TypeReply:
+		return who + " replied to your chirp"
+	case TypeMention:
+		return who + " mentioned you"
+	case TypeFollow:
+		return who + " followed you"
+	case TypeChirpyRed:
+		return "Welcome to Chirpy Red!"
+	case TypeWarning:
+		return "You received a warning from the moderators"
+	}
+	return "You have a new notification"
+}
@@ -0,0 +1,36 @@
+package notify
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// TestGroupKey tests that likes group per chirp and replies don't group
+func TestGroupKey(t *testing.T) {
+	chirpID := uuid.NullUUID{UUID: uuid.New(), Valid: true}
+	first := groupKey(Event{Type: TypeLike, ChirpID: chirpID, Actor: uuid.NullUUID{UUID: uuid.New(), Valid: true}})
+	second := groupKey(Event{Type: TypeLike, ChirpID: chirpID, Actor: uuid.NullUUID{UUID: uuid.New(), Valid: true}})
+	if !first.Valid || first != second {
+		t.Fatal("Likes on the same chirp not grouped.")
+	}
+	other := groupKey(Event{Type: TypeLike, ChirpID: uuid.NullUUID{UUID: uuid.New(), Valid: true}})
+	if other == first {
+		t.Fatal("Likes on different chirps grouped.")
+	}
+	if groupKey(Event{Type: TypeReply, ChirpID: chirpID}).Valid {
+		t.Fatal("Replies grouped.")
+	}
+}
+
+func TestMessage(t *testing.T) {
+	if msg := Message(TypeLike, 5); msg != "5 people liked your chirp" {
+		t.Fatalf("Unexpected message: %s", msg)
+	}
+	if msg := Message(TypeFollow, 1); msg != "Someone followed you" {
+		t.Fatalf("Unexpected message: %s", msg)
+	}
+	if msg := Message(TypeWarning, 1); msg != "You received a warning from the moderators" {
+		t.Fatalf("Unexpected message: %s", msg)
+	}
+}
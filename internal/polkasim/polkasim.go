@@ -0,0 +1,213 @@
+// Package polkasim is a fake Polka for testing billing flows offline. It
+// sends signed webhooks the way Polka does, retrying rejected deliveries,
+// and can misbehave on purpose with failed attempts, delays and duplicates.
+package polkasim
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/curtisbraxdale/chirpy/internal/webhook"
+	"github.com/google/uuid"
+)
+
+// Events the simulator can send.
+const (
+	EventUpgraded   = "user.upgraded"
+	EventDowngraded = "user.downgraded"
+	EventRefunded   = "subscription.refunded"
+)
+
+const (
+	defaultMaxAttempts = 5
+	defaultRetryBase   = time.Second
+	// badSecret signs attempts that are meant to be rejected.
+	badSecret = "polkasim-invalid-secret"
+)
+
+var ErrNotDelivered = errors.New("Webhook was not accepted.")
+
+// Options configures a Simulator. Only URL and Secrets are required.
+type Options struct {
+	// URL is Chirpy's Polka webhook endpoint.
+	URL     string
+	Secrets []string
+	// FailureRate is the fraction of attempts, from 0 to 1, sent with an
+	// invalid signature so the receiver rejects them.
+	FailureRate float64
+	// Delay is how long to wait before each attempt.
+	Delay time.Duration
+	// Duplicates is how many extra copies of a delivery are sent after it
+	// is accepted, with the same delivery ID.
+	Duplicates int
+	// MaxAttempts is how many times a delivery is tried before giving up.
+	MaxAttempts int
+	// RetryBase is the first retry delay, doubled on each retry.
+	RetryBase time.Duration
+	// Seed makes the failures repeatable. Zero picks a random seed.
+	Seed   uint64
+	Client *http.Client
+}
+
+// Simulator sends webhooks to one Chirpy. It is safe for concurrent use.
+type Simulator struct {
+	opts Options
+	mu   sync.Mutex
+	rng  *rand.Rand
+}
+
+// New creates a simulator, filling in defaults for unset options.
+func New(opts Options) *Simulator {
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = defaultMaxAttempts
+	}
+	if opts.RetryBase <= 0 {
+		opts.RetryBase = defaultRetryBase
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	seed := opts.Seed
+	if seed == 0 {
+		seed = rand.Uint64()
+	}
+	return &Simulator{opts: opts, rng: rand.New(rand.NewPCG(seed, seed))}
+}
+
+// Event is the body of a Polka webhook.
+type Event struct {
+	Event string    `json:"event"`
+	Data  EventData `json:"data"`
+}
+
+type EventData struct {
+	UserID    string     `json:"user_id"`
+	Plan      string     `json:"plan,omitempty"`
+	PeriodEnd *time.Time `json:"period_end,omitempty"`
+}
+
+// NewEvent creates an event for a Chirpy Red subscription. periodEnd is left
+// out if zero.
+func NewEvent(event string, userID uuid.UUID, periodEnd time.Time) Event {
+	e := Event{Event: event, Data: EventData{UserID: userID.String(), Plan: "red"}}
+	if !periodEnd.IsZero() {
+		periodEnd = periodEnd.UTC()
+		e.Data.PeriodEnd = &periodEnd
+	}
+	return e
+}
+
+// Attempt is one request the simulator made.
+type Attempt struct {
+	// Status is zero if the request failed before a response.
+	Status    int
+	Err       error
+	Sabotaged bool
+	Duplicate bool
+}
+
+// Result describes everything sent for one delivery.
+type Result struct {
+	ID        string
+	Attempts  []Attempt
+	Delivered bool
+}
+
+// Send delivers an event, retrying with backoff until it is accepted or
+// MaxAttempts is reached, then sends any duplicates. It returns
+// ErrNotDelivered if no attempt was accepted.
+func (s *Simulator) Send(ctx context.Context, event Event) (Result, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return Result{}, err
+	}
+	result := Result{ID: uuid.NewString()}
+	for attempt := 1; attempt <= s.opts.MaxAttempts && !result.Delivered; attempt++ {
+		if attempt > 1 {
+			err = sleep(ctx, webhook.Backoff(attempt-1, s.opts.RetryBase, 32*s.opts.RetryBase))
+			if err != nil {
+				return result, err
+			}
+		}
+		a, err := s.attempt(ctx, result.ID, body, s.sabotage())
+		if err != nil {
+			return result, err
+		}
+		result.Attempts = append(result.Attempts, a)
+		result.Delivered = a.Err == nil
+	}
+	if !result.Delivered {
+		return result, ErrNotDelivered
+	}
+	for range s.opts.Duplicates {
+		a, err := s.attempt(ctx, result.ID, body, false)
+		if err != nil {
+			return result, err
+		}
+		a.Duplicate = true
+		result.Attempts = append(result.Attempts, a)
+	}
+	return result, nil
+}
+
+func (s *Simulator) sabotage() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rng.Float64() < s.opts.FailureRate
+}
+
+// attempt makes one request. A failed request is recorded in the Attempt;
+// the error is only for a cancelled context.
+func (s *Simulator) attempt(ctx context.Context, id string, body []byte, sabotaged bool) (Attempt, error) {
+	err := sleep(ctx, s.opts.Delay)
+	if err != nil {
+		return Attempt{}, err
+	}
+	a := Attempt{Sabotaged: sabotaged}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.opts.URL, bytes.NewReader(body))
+	if err != nil {
+		return Attempt{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	secrets := s.opts.Secrets
+	if sabotaged {
+		secrets = []string{badSecret}
+	}
+	webhook.SetHeaders(req.Header, secrets, id, time.Now(), body)
+	resp, err := s.opts.Client.Do(req)
+	if ctx.Err() != nil {
+		return Attempt{}, ctx.Err()
+	}
+	if err != nil {
+		a.Err = err
+		return a, nil
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	a.Status = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		a.Err = errors.New(resp.Status)
+	}
+	return a, nil
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
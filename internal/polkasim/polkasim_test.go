@@ -0,0 +1,127 @@
+package polkasim
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/curtisbraxdale/chirpy/internal/webhook"
+	"github.com/google/uuid"
+)
+
+// receiver accepts deliveries signed with secret and records their IDs.
+type receiver struct {
+	mu       sync.Mutex
+	accepted []string
+	rejected int
+}
+
+func (r *receiver) handler(secret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		id, err := webhook.Verify(req.Header, body, []string{secret}, webhook.DefaultTolerance, time.Now())
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if err != nil {
+			r.rejected++
+			w.WriteHeader(401)
+			return
+		}
+		r.accepted = append(r.accepted, id)
+		w.WriteHeader(204)
+	}
+}
+
+// TestSend tests that a delivery is signed and accepted on the first try
+func TestSend(t *testing.T) {
+	r := &receiver{}
+	server := httptest.NewServer(r.handler("secret"))
+	defer server.Close()
+
+	sim := New(Options{URL: server.URL, Secrets: []string{"secret"}})
+	result, err := sim.Send(context.Background(), NewEvent(EventUpgraded, uuid.New(), time.Now().Add(time.Hour)))
+	if err != nil {
+		t.Fatalf("Error sending webhook: %s", err)
+	}
+	if !result.Delivered || len(result.Attempts) != 1 || result.Attempts[0].Status != 204 {
+		t.Fatalf("Result = %+v", result)
+	}
+	if len(r.accepted) != 1 || r.accepted[0] != result.ID {
+		t.Fatalf("Accepted = %v, want [%s]", r.accepted, result.ID)
+	}
+}
+
+func TestSendRetriesFailures(t *testing.T) {
+	r := &receiver{}
+	server := httptest.NewServer(r.handler("secret"))
+	defer server.Close()
+
+	sim := New(Options{URL: server.URL, Secrets: []string{"secret"}, FailureRate: 0.5, MaxAttempts: 20, RetryBase: time.Millisecond, Seed: 1})
+	for range 10 {
+		result, err := sim.Send(context.Background(), NewEvent(EventDowngraded, uuid.New(), time.Time{}))
+		if err != nil {
+			t.Fatalf("Error sending webhook: %s", err)
+		}
+		for _, a := range result.Attempts[:len(result.Attempts)-1] {
+			if !a.Sabotaged || a.Status != 401 {
+				t.Fatalf("Failed attempt = %+v", a)
+			}
+		}
+	}
+	if len(r.accepted) != 10 || r.rejected == 0 {
+		t.Fatalf("Accepted %d and rejected %d, want 10 and some", len(r.accepted), r.rejected)
+	}
+}
+
+func TestSendGivesUp(t *testing.T) {
+	r := &receiver{}
+	server := httptest.NewServer(r.handler("secret"))
+	defer server.Close()
+
+	sim := New(Options{URL: server.URL, Secrets: []string{"secret"}, FailureRate: 1, MaxAttempts: 3, RetryBase: time.Millisecond})
+	result, err := sim.Send(context.Background(), NewEvent(EventRefunded, uuid.New(), time.Time{}))
+	if !errors.Is(err, ErrNotDelivered) {
+		t.Fatalf("Error = %v, want %s", err, ErrNotDelivered)
+	}
+	if len(result.Attempts) != 3 || r.rejected != 3 {
+		t.Fatalf("Made %d attempts, receiver rejected %d, want 3", len(result.Attempts), r.rejected)
+	}
+}
+
+func TestSendDuplicates(t *testing.T) {
+	r := &receiver{}
+	server := httptest.NewServer(r.handler("secret"))
+	defer server.Close()
+
+	sim := New(Options{URL: server.URL, Secrets: []string{"secret"}, Duplicates: 2})
+	result, err := sim.Send(context.Background(), NewEvent(EventUpgraded, uuid.New(), time.Time{}))
+	if err != nil {
+		t.Fatalf("Error sending webhook: %s", err)
+	}
+	if len(r.accepted) != 3 {
+		t.Fatalf("Accepted %d deliveries, want 3", len(r.accepted))
+	}
+	for _, id := range r.accepted {
+		if id != result.ID {
+			t.Fatalf("Duplicate ID = %s, want %s", id, result.ID)
+		}
+	}
+	if !result.Attempts[1].Duplicate || !result.Attempts[2].Duplicate {
+		t.Fatalf("Attempts = %+v", result.Attempts)
+	}
+}
+
+func TestSendCancelled(t *testing.T) {
+	sim := New(Options{URL: "http://127.0.0.1:1", Secrets: []string{"secret"}, Delay: time.Hour})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := sim.Send(ctx, NewEvent(EventUpgraded, uuid.New(), time.Time{}))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Error = %v, want %s", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,131 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/curtisbraxdale/chirpy/internal/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const (
+	channelName = "stream_events"
+	// Signals are ephemeral events like typing that skip storage.
+	signalChannelName = "stream_signals"
+	// Events are kept this long for clients resuming with Last-Event-ID.
+	retention   = 24 * time.Hour
+	replayLimit = 500
+	// replayWindow is how many IDs before Last-Event-ID are read again on
+	// resume. IDs are taken at insert, so an event can commit, and reach
+	// subscribers, after one with a higher ID.
+	replayWindow = 100
+)
+
+// Broker publishes events through Postgres. Each event is stored in
+// stream_events, whose insert trigger sends a NOTIFY that every server
+// instance listens for and hands to its local Hub.
+type Broker struct {
+	Hub     *Hub
+	queries *database.Queries
+	dbURL   string
+}
+
+func NewBroker(dbURL string, queries *database.Queries) *Broker {
+	return &Broker{Hub: NewHub(), queries: queries, dbURL: dbURL}
+}
+
+// Publish stores an event. Subscribers receive it once the NOTIFY comes back,
+// including on this instance.
+func (b *Broker) Publish(ctx context.Context, eventType string, userID uuid.UUID, payload interface{}) error {
+	dat, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	_, err = b.queries.CreateStreamEvent(ctx, database.CreateStreamEventParams{Type: eventType, UserID: userID, Payload: dat})
+	return err
+}
+
+// Signal sends an ephemeral event to every instance without storing it, so it
+// has no ID and can't be replayed.
+func (b *Broker) Signal(ctx context.Context, eventType string, userID uuid.UUID, payload interface{}) error {
+	dat, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	event, err := json.Marshal(Event{Type: eventType, UserID: userID, Payload: dat})
+	if err != nil {
+		return err
+	}
+	return b.queries.NotifyStreamSignal(ctx, string(event))
+}
+
+// Replay returns stored events for a client resuming after lastID, oldest
+// first. It starts replayWindow IDs early so events that committed out of
+// order aren't lost, which means the client may see some events again. It
+// reports false if there were too many events to replay, in which case the
+// client should start over.
+func (b *Broker) Replay(ctx context.Context, lastID int64) ([]Event, bool, error) {
+	dbEvents, err := b.queries.ListStreamEventsAfter(ctx, database.ListStreamEventsAfterParams{ID: max(lastID-replayWindow, 0), Limit: replayWindow + replayLimit + 1})
+	if err != nil {
+		return nil, false, err
+	}
+	if len(dbEvents) > replayWindow+replayLimit {
+		return nil, false, nil
+	}
+	events := []Event{}
+	for _, e := range dbEvents {
+		events = append(events, Event{ID: e.ID, Type: e.Type, UserID: e.UserID, Payload: e.Payload})
+	}
+	return events, true, nil
+}
+
+// Run listens for notifications until ctx is cancelled, and prunes old events
+// on the side.
+func (b *Broker) Run(ctx context.Context) error {
+	listener := pq.NewListener(b.dbURL, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			slog.Error("Stream listener error", "error", err)
+		}
+	})
+	defer listener.Close()
+	err := listener.Listen(channelName)
+	if err != nil {
+		return err
+	}
+	err = listener.Listen(signalChannelName)
+	if err != nil {
+		return err
+	}
+
+	prune := time.NewTicker(time.Hour)
+	defer prune.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case n := <-listener.Notify:
+			// A nil notification means the connection was re-established.
+			if n == nil {
+				slog.Info("Stream listener reconnected")
+				continue
+			}
+			event := Event{}
+			err := json.Unmarshal([]byte(n.Extra), &event)
+			if err != nil {
+				slog.Error("Error decoding stream event", "error", err)
+				continue
+			}
+			b.Hub.Broadcast(event)
+		case <-time.After(90 * time.Second):
+			go listener.Ping()
+		case <-prune.C:
+			err := b.queries.DeleteStreamEventsOlderThan(ctx, int64(retention.Seconds()))
+			if err != nil {
+				slog.Error("Error pruning stream events", "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package pubsub
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ChirpCreated = "chirp.created"
+	ChirpDeleted = "chirp.deleted"
+	Notification = "notification"
+	// MessageCreated is addressed to one recipient, like Notification.
+	MessageCreated = "message.created"
+	// Reset tells a resuming client that events were missed and it should
+	// reload instead.
+	Reset = "reset"
+)
+
+// Event is one message on the stream. ID increases across every server
+// instance, so clients can resume from the last one they saw, but events can
+// arrive out of ID order and be sent again on resume, so clients should
+// ignore IDs they already have. UserID is the
+// chirp author, or the recipient for notifications and direct messages.
+type Event struct {
+	ID      int64           `json:"id"`
+	Type    string          `json:"type"`
+	UserID  uuid.UUID       `json:"user_id"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// subscriberBuffer is how far a subscriber can fall behind before the hub
+// gives up on it.
+const subscriberBuffer = 64
+
+// Hub fans events out to the subscribers in this process.
+type Hub struct {
+	mu          sync.Mutex
+	subscribers map[*Subscription]struct{}
+}
+
+type Subscription struct {
+	hub    *Hub
+	filter func(Event) bool
+	events chan Event
+}
+
+func NewHub() *Hub {
+	return &Hub{subscribers: map[*Subscription]struct{}{}}
+}
+
+// Subscribe returns a subscription that receives every event the filter
+// accepts. A nil filter accepts everything.
+func (h *Hub) Subscribe(filter func(Event) bool) *Subscription {
+	sub := &Subscription{hub: h, filter: filter, events: make(chan Event, subscriberBuffer)}
+	h.mu.Lock()
+	h.subscribers[sub] = struct{}{}
+	h.mu.Unlock()
+	return sub
+}
+
+// Broadcast delivers an event to local subscribers without blocking. A
+// subscriber whose buffer is full is dropped and its channel closed, so one
+// slow reader can't hold up the rest.
+func (h *Hub) Broadcast(event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subscribers {
+		if sub.filter != nil && !sub.filter(event) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			delete(h.subscribers, sub)
+			close(sub.events)
+		}
+	}
+}
+
+// Events is closed when the subscription is dropped or closed.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	if _, ok := s.hub.subscribers[s]; ok {
+		delete(s.hub.subscribers, s)
+		close(s.events)
+	}
+}
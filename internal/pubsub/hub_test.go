@@ -0,0 +1,40 @@
+package pubsub
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// TestBroadcastFilter tests that subscribers only get events their filter accepts
+func TestBroadcastFilter(t *testing.T) {
+	hub := NewHub()
+	author := uuid.New()
+	sub := hub.Subscribe(func(e Event) bool { return e.UserID == author })
+	defer sub.Close()
+
+	hub.Broadcast(Event{ID: 1, Type: ChirpCreated, UserID: uuid.New()})
+	hub.Broadcast(Event{ID: 2, Type: ChirpCreated, UserID: author})
+
+	event := <-sub.Events()
+	if event.ID != 2 {
+		t.Fatalf("Unexpected event: %d", event.ID)
+	}
+}
+
+func TestSlowSubscriberDropped(t *testing.T) {
+	hub := NewHub()
+	sub := hub.Subscribe(nil)
+	for i := 0; i <= subscriberBuffer; i++ {
+		hub.Broadcast(Event{ID: int64(i)})
+	}
+	received := 0
+	for range sub.Events() {
+		received++
+	}
+	if received != subscriberBuffer {
+		t.Fatalf("Received %d events, expected %d.", received, subscriberBuffer)
+	}
+	// Closing a dropped subscription is a no-op.
+	sub.Close()
+}
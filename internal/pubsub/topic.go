@@ -0,0 +1,84 @@
+package pubsub
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Typing is an ephemeral presence event. It is signalled between instances
+// but never stored or replayed.
+const Typing = "typing"
+
+// Topic is something a live connection can subscribe to: a user's chirps, a
+// hashtag, or a thread.
+type Topic struct {
+	Kind  string
+	Value string
+}
+
+var (
+	hashtagPattern = regexp.MustCompile(`#([\p{L}\p{N}_]+)`)
+	validTag       = regexp.MustCompile(`^[\p{L}\p{N}_]+$`)
+)
+
+func ParseTopic(raw string) (Topic, error) {
+	kind, value, found := strings.Cut(raw, ":")
+	if !found || value == "" {
+		return Topic{}, errors.New("Topic must look like kind:value.")
+	}
+	switch kind {
+	case "user", "thread":
+		id, err := uuid.Parse(value)
+		if err != nil {
+			return Topic{}, errors.New("Topic needs a valid id.")
+		}
+		return Topic{Kind: kind, Value: id.String()}, nil
+	case "hashtag":
+		tag := strings.ToLower(strings.TrimPrefix(value, "#"))
+		if !validTag.MatchString(tag) {
+			return Topic{}, errors.New("Invalid hashtag.")
+		}
+		return Topic{Kind: kind, Value: tag}, nil
+	}
+	return Topic{}, errors.New("Topic kind must be user, hashtag or thread.")
+}
+
+func (t Topic) String() string {
+	return t.Kind + ":" + t.Value
+}
+
+// Matches reports whether an event belongs to the topic. Typing events carry
+// the topic they were sent to.
+func (t Topic) Matches(e Event) bool {
+	payload := struct {
+		ID    uuid.UUID `json:"id"`
+		Body  string    `json:"body"`
+		Topic string    `json:"topic"`
+	}{}
+	if err := json.Unmarshal(e.Payload, &payload); err != nil {
+		return false
+	}
+	if e.Type == Typing {
+		return payload.Topic == t.String()
+	}
+	if e.Type != ChirpCreated && e.Type != ChirpDeleted {
+		return false
+	}
+	switch t.Kind {
+	case "user":
+		return e.UserID.String() == t.Value
+	case "thread":
+		return payload.ID.String() == t.Value
+	case "hashtag":
+		for _, match := range hashtagPattern.FindAllStringSubmatch(payload.Body, -1) {
+			if strings.ToLower(match[1]) == t.Value {
+				return true
+			}
+		}
+	}
+	return false
+}
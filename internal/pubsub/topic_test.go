@@ -0,0 +1,59 @@
+package pubsub
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func chirpEvent(t *testing.T, author uuid.UUID, id uuid.UUID, body string) Event {
+	payload, err := json.Marshal(map[string]interface{}{"id": id, "body": body})
+	if err != nil {
+		t.Fatalf("Error marshalling payload: %s", err)
+	}
+	return Event{ID: 1, Type: ChirpCreated, UserID: author, Payload: payload}
+}
+
+// TestTopicMatches tests matching chirps against each topic kind
+func TestTopicMatches(t *testing.T) {
+	author, chirpID := uuid.New(), uuid.New()
+	event := chirpEvent(t, author, chirpID, "Loving the #GoLang meetup")
+
+	for _, raw := range []string{"user:" + author.String(), "thread:" + chirpID.String(), "hashtag:golang", "hashtag:#GoLang"} {
+		topic, err := ParseTopic(raw)
+		if err != nil {
+			t.Fatalf("Error parsing topic %s: %s", raw, err)
+		}
+		if !topic.Matches(event) {
+			t.Fatalf("Topic %s didn't match.", raw)
+		}
+	}
+
+	topic, err := ParseTopic("hashtag:go")
+	if err != nil {
+		t.Fatalf("Error parsing topic: %s", err)
+	}
+	if topic.Matches(event) {
+		t.Fatal("Hashtag matched a longer tag.")
+	}
+}
+
+func TestTypingMatches(t *testing.T) {
+	topic, err := ParseTopic("thread:" + uuid.New().String())
+	if err != nil {
+		t.Fatalf("Error parsing topic: %s", err)
+	}
+	payload, _ := json.Marshal(map[string]string{"topic": topic.String()})
+	if !topic.Matches(Event{Type: Typing, UserID: uuid.New(), Payload: payload}) {
+		t.Fatal("Typing event didn't match its topic.")
+	}
+}
+
+func TestParseTopicErrors(t *testing.T) {
+	for _, raw := range []string{"user", "user:not-a-uuid", "hashtag:", "hashtag:two words", "room:1"} {
+		if _, err := ParseTopic(raw); err == nil {
+			t.Fatalf("Parsed invalid topic %s.", raw)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package search
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Query is a parsed search string. Text keeps the free terms and quoted
+// phrases in websearch_to_tsquery syntax, the operators are pulled out.
+type Query struct {
+	Text  string
+	From  string
+	Since time.Time
+	Until time.Time
+}
+
+// Parse splits a raw search string into free text and the from:, since: and
+// until: operators. Dates are YYYY-MM-DD or RFC3339, and a plain date in
+// until: includes the whole day.
+func Parse(raw string) (Query, error) {
+	query := Query{}
+	terms := []string{}
+	for _, token := range tokenize(raw) {
+		key, value, found := strings.Cut(token, ":")
+		if !found || strings.HasPrefix(token, "\"") {
+			terms = append(terms, token)
+			continue
+		}
+		switch strings.ToLower(key) {
+		case "from":
+			query.From = strings.TrimPrefix(value, "@")
+			if query.From == "" {
+				return Query{}, errors.New("Missing handle in from: operator.")
+			}
+		case "since":
+			since, err := parseDate(value, false)
+			if err != nil {
+				return Query{}, errors.New("Couldn't parse since: date.")
+			}
+			query.Since = since
+		case "until":
+			until, err := parseDate(value, true)
+			if err != nil {
+				return Query{}, errors.New("Couldn't parse until: date.")
+			}
+			query.Until = until
+		default:
+			terms = append(terms, token)
+		}
+	}
+	if !query.Since.IsZero() && !query.Until.IsZero() && !query.Since.Before(query.Until) {
+		return Query{}, errors.New("since: must be before until:.")
+	}
+	query.Text = strings.Join(terms, " ")
+	return query, nil
+}
+
+// IsEmpty reports whether the query has neither text nor operators.
+func (q Query) IsEmpty() bool {
+	return q.Text == "" && q.From == "" && q.Since.IsZero() && q.Until.IsZero()
+}
+
+// tokenize splits on whitespace, keeping quoted phrases together with their
+// quotes. An unterminated quote runs to the end of the input.
+func tokenize(raw string) []string {
+	tokens := []string{}
+	var current strings.Builder
+	inQuotes := false
+	for _, r := range raw {
+		switch {
+		case r == '"':
+			current.WriteRune(r)
+			inQuotes = !inQuotes
+		case unicode.IsSpace(r) && !inQuotes:
+			if current.Len() > 0 {
+				tokens = append(tokens, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		token := current.String()
+		if inQuotes {
+			token += "\""
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
+
+func parseDate(value string, endOfDay bool) (time.Time, error) {
+	date, err := time.Parse(time.DateOnly, value)
+	if err == nil {
+		if endOfDay {
+			date = date.AddDate(0, 0, 1)
+		}
+		return date, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
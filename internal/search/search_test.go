@@ -0,0 +1,65 @@
+package search
+
+import (
+	"testing"
+	"time"
+)
+
+// TestParseOperators tests that operators are pulled out of the free text
+func TestParseOperators(t *testing.T) {
+	query, err := Parse(`hello from:@alice "good morning" since:2024-01-01 until:2024-01-31 world`)
+	if err != nil {
+		t.Fatalf("Error parsing query: %s", err)
+	}
+	if query.Text != `hello "good morning" world` {
+		t.Fatalf("Unexpected text: %s", query.Text)
+	}
+	if query.From != "alice" {
+		t.Fatalf("Unexpected handle: %s", query.From)
+	}
+	if !query.Since.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("Unexpected since: %s", query.Since)
+	}
+	if !query.Until.Equal(time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("Unexpected until: %s", query.Until)
+	}
+}
+
+func TestParseQuotedOperator(t *testing.T) {
+	query, err := Parse(`"from:alice said"`)
+	if err != nil {
+		t.Fatalf("Error parsing query: %s", err)
+	}
+	if query.From != "" || query.Text != `"from:alice said"` {
+		t.Fatal("Parsed operator inside a phrase.")
+	}
+}
+
+func TestParseUnterminatedPhrase(t *testing.T) {
+	query, err := Parse(`"good morning`)
+	if err != nil {
+		t.Fatalf("Error parsing query: %s", err)
+	}
+	if query.Text != `"good morning"` {
+		t.Fatalf("Unexpected text: %s", query.Text)
+	}
+}
+
+func TestParseBadDates(t *testing.T) {
+	if _, err := Parse("since:yesterday"); err == nil {
+		t.Fatal("Parsed invalid since date.")
+	}
+	if _, err := Parse("since:2024-02-01 until:2024-01-01"); err == nil {
+		t.Fatal("Parsed since after until.")
+	}
+}
+
+func TestIsEmpty(t *testing.T) {
+	query, err := Parse("   ")
+	if err != nil {
+		t.Fatalf("Error parsing query: %s", err)
+	}
+	if !query.IsEmpty() {
+		t.Fatal("Blank query not empty.")
+	}
+}
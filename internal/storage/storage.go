@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Store keeps uploaded blobs and knows the public URL they're served from.
+type Store interface {
+	Put(ctx context.Context, key, contentType string, data []byte) error
+	Delete(ctx context.Context, key string) error
+	URL(key string) string
+}
+
+var errInvalidKey = errors.New("Invalid storage key.")
+
+// validKey rejects keys that could escape the store, like "../x" or "/x".
+func validKey(key string) bool {
+	return key != "" && !strings.HasPrefix(key, "/") && filepath.Clean(key) == key && !strings.HasPrefix(key, "..")
+}
+
+// Local stores blobs under a directory, which the server exposes at BaseURL.
+type Local struct {
+	Dir     string
+	BaseURL string
+}
+
+func (l Local) Put(ctx context.Context, key, contentType string, data []byte) error {
+	if !validKey(key) {
+		return errInvalidKey
+	}
+	path := filepath.Join(l.Dir, key)
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file first so readers never see half a blob.
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (l Local) Delete(ctx context.Context, key string) error {
+	if !validKey(key) {
+		return errInvalidKey
+	}
+	err := os.Remove(filepath.Join(l.Dir, key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (l Local) URL(key string) string {
+	return strings.TrimSuffix(l.BaseURL, "/") + "/" + key
+}
+
+// FileSystem returns the directory for serving blobs over HTTP. Directories
+// can't be opened, so their contents are never listed.
+func (l Local) FileSystem() http.FileSystem {
+	return filesOnly{http.Dir(l.Dir)}
+}
+
+type filesOnly struct {
+	fs http.FileSystem
+}
+
+func (f filesOnly) Open(name string) (http.File, error) {
+	file, err := f.fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		file.Close()
+		return nil, fs.ErrNotExist
+	}
+	return file, nil
+}
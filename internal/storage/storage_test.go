@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestLocal tests that blobs round-trip through the filesystem
+func TestLocal(t *testing.T) {
+	dir := t.TempDir()
+	store := Local{Dir: dir, BaseURL: "http://localhost:8080/media/"}
+	ctx := context.Background()
+
+	if err := store.Put(ctx, "media/a.png", "image/png", []byte("data")); err != nil {
+		t.Fatalf("Error putting blob: %s", err)
+	}
+	got, err := os.ReadFile(filepath.Join(dir, "media", "a.png"))
+	if err != nil || string(got) != "data" {
+		t.Fatalf("Unexpected blob: %q %v", got, err)
+	}
+	if url := store.URL("media/a.png"); url != "http://localhost:8080/media/media/a.png" {
+		t.Fatalf("Unexpected URL: %s", url)
+	}
+	if err := store.Delete(ctx, "media/a.png"); err != nil {
+		t.Fatalf("Error deleting blob: %s", err)
+	}
+	if err := store.Delete(ctx, "media/a.png"); err != nil {
+		t.Fatalf("Deleting a missing blob should succeed: %s", err)
+	}
+	if err := store.Put(ctx, "../escape", "text/plain", nil); err == nil {
+		t.Fatal("Expected error for key outside the store.")
+	}
+}
+
+// TestLocalFileSystem tests that blobs are served but directories aren't listed
+func TestLocalFileSystem(t *testing.T) {
+	store := Local{Dir: t.TempDir()}
+	if err := store.Put(context.Background(), "media/a.png", "image/png", []byte("data")); err != nil {
+		t.Fatalf("Error putting blob: %s", err)
+	}
+	server := httptest.NewServer(http.FileServer(store.FileSystem()))
+	defer server.Close()
+
+	for path, want := range map[string]int{"/media/a.png": 200, "/media/": 404, "/": 404, "/media": 404} {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("Error requesting %s: %s", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Fatalf("Expected %d for %s, got %d", want, path, resp.StatusCode)
+		}
+	}
+}
+
+// fakeS3 stands in for an S3-compatible service. It checks that requests
+// carry a SigV4 header for the expected credentials and payload.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	types   map[string]string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	auth := req.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/") || !strings.Contains(auth, "/us-east-1/s3/aws4_request") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	body, _ := io.ReadAll(req.Body)
+	if req.Header.Get("X-Amz-Content-Sha256") != sha256Hex(body) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch req.Method {
+	case http.MethodPut:
+		f.objects[req.URL.Path] = body
+		f.types[req.URL.Path] = req.Header.Get("Content-Type")
+	case http.MethodDelete:
+		delete(f.objects, req.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestS3(t *testing.T) {
+	fake := &fakeS3{objects: map[string][]byte{}, types: map[string]string{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	store := S3{Endpoint: server.URL, Region: "us-east-1", Bucket: "chirpy", AccessKey: "AKID", SecretKey: "secret"}
+	ctx := context.Background()
+	if err := store.Put(ctx, "media/a.jpg", "image/jpeg", []byte("jpeg")); err != nil {
+		t.Fatalf("Error putting object: %s", err)
+	}
+	if string(fake.objects["/chirpy/media/a.jpg"]) != "jpeg" || fake.types["/chirpy/media/a.jpg"] != "image/jpeg" {
+		t.Fatalf("Object not stored: %v", fake.objects)
+	}
+	if url := store.URL("media/a.jpg"); url != server.URL+"/chirpy/media/a.jpg" {
+		t.Fatalf("Unexpected URL: %s", url)
+	}
+	if err := store.Delete(ctx, "media/a.jpg"); err != nil {
+		t.Fatalf("Error deleting object: %s", err)
+	}
+	if len(fake.objects) != 0 {
+		t.Fatal("Object not deleted.")
+	}
+
+	store.AccessKey = "WRONG"
+	if err := store.Put(ctx, "media/b.jpg", "image/jpeg", []byte("jpeg")); err == nil {
+		t.Fatal("Expected error for rejected request.")
+	}
+}
+
+func TestSigningKey(t *testing.T) {
+	// Example from the AWS Signature Version 4 documentation.
+	key := signingKey("wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "20120215", "us-east-1", "iam")
+	want := "f4780e2d9f65fa895f9c67b32ce1baf0b0d8a43505a000a1a9e090d414db404d"
+	if hex.EncodeToString(key) != want {
+		t.Fatalf("Unexpected signing key: %x", key)
+	}
+}
@@ -0,0 +1,26 @@
+package textlen
+
+import (
+	"regexp"
+
+	"github.com/rivo/uniseg"
+)
+
+// URLWeight is what every link counts for, however long it is, so
+// shorteners don't buy extra room.
+const URLWeight = 23
+
+var urlPattern = regexp.MustCompile(`(?i)\bhttps?://[^\s<>"]+`)
+
+// Count returns the length of a chirp as readers see it: user-perceived
+// characters (grapheme clusters), so an emoji with skin tone or a letter with
+// combining accents counts once, with each URL counting as URLWeight.
+func Count(text string) int {
+	count := 0
+	prev := 0
+	for _, span := range urlPattern.FindAllStringIndex(text, -1) {
+		count += uniseg.GraphemeClusterCount(text[prev:span[0]]) + URLWeight
+		prev = span[1]
+	}
+	return count + uniseg.GraphemeClusterCount(text[prev:])
+}
@@ -0,0 +1,31 @@
+package textlen
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestCount tests that characters are counted as readers see them
+func TestCount(t *testing.T) {
+	cases := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"hello", 5},
+		{"héllo", 5},
+		{"héllo", 5},
+		{"日本語", 3},
+		{"\U0001F44D\U0001F3FD", 1},
+		{"\U0001F468‍\U0001F469‍\U0001F467 family", 8},
+		{"\U0001F1FA\U0001F1F8", 1},
+		{"see https://example.com/a/very/long/path?with=query ok", 4 + URLWeight + 3},
+		{"http://a.co", URLWeight},
+		{strings.Repeat("\U0001F600", 140), 140},
+	}
+	for _, c := range cases {
+		if got := Count(c.text); got != c.want {
+			t.Fatalf("Count(%q) = %d, want %d", c.text, got, c.want)
+		}
+	}
+}
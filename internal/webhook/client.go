@@ -0,0 +1,138 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// ErrBlockedAddress is returned when an endpoint resolves to an address that
+// webhooks may not be sent to.
+var ErrBlockedAddress = errors.New("Endpoint address is not allowed.")
+
+// blockedPrefixes are ranges that aren't covered by the netip predicates but
+// still reach internal networks.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+}
+
+// PublicAddr reports whether webhooks may be sent to addr. Loopback, private,
+// link-local, multicast and unspecified addresses are refused.
+func PublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() || addr.IsMulticast() || addr.IsUnspecified() {
+		return false
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// SendError is a failed delivery. Error returns a message that is safe to show
+// to the endpoint's owner; Unwrap returns the underlying cause.
+type SendError struct {
+	Message string
+	Err     error
+}
+
+func (e *SendError) Error() string {
+	return e.Message
+}
+
+func (e *SendError) Unwrap() error {
+	return e.Err
+}
+
+// Client delivers signed webhooks.
+type Client struct {
+	httpClient *http.Client
+	userAgent  string
+}
+
+// NewClient creates a client whose requests give up after timeout. Unless
+// allowPrivate is set, connections to non-public addresses are refused when
+// dialing, so a hostname can't be rebound to an internal address after it was
+// checked. Redirects are never followed.
+func NewClient(timeout time.Duration, userAgent string, allowPrivate bool) *Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil || !PublicAddr(addrPort.Addr()) {
+				return ErrBlockedAddress
+			}
+			return nil
+		}
+	}
+	transport := &http.Transport{
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   timeout,
+		ExpectContinueTimeout: time.Second,
+	}
+	httpClient := &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return &Client{httpClient: httpClient, userAgent: userAgent}
+}
+
+// Send posts a JSON body to url, signed with secret. It returns the response
+// status, and a *SendError if the request failed or the status wasn't 2xx.
+func (c *Client) Send(ctx context.Context, url, secret, id string, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, &SendError{Message: "Invalid endpoint URL.", Err: err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", c.userAgent)
+	SetHeaders(req.Header, []string{secret}, id, time.Now(), body)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, &SendError{Message: transportMessage(err), Err: err}
+	}
+	defer resp.Body.Close()
+	// Drain a little so the connection can be reused.
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message := fmt.Sprintf("Endpoint returned status %d.", resp.StatusCode)
+		return resp.StatusCode, &SendError{Message: message, Err: errors.New(message)}
+	}
+	return resp.StatusCode, nil
+}
+
+// transportMessage classifies a transport error without exposing addresses or
+// other details of the network.
+func transportMessage(err error) string {
+	var netErr net.Error
+	var dnsErr *net.DNSError
+	switch {
+	case errors.Is(err, ErrBlockedAddress):
+		return ErrBlockedAddress.Error()
+	case errors.As(err, &dnsErr):
+		return "Endpoint host could not be resolved."
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "Request timed out."
+	default:
+		return "Could not connect to endpoint."
+	}
+}
@@ -0,0 +1,108 @@
+// Package webhook signs and verifies webhook deliveries. A signature is an
+// HMAC-SHA256 over the delivery ID, the Unix timestamp and the raw body, so
+// none of them can be changed or replayed outside the tolerance window.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	HeaderID        = "Webhook-Id"
+	HeaderTimestamp = "Webhook-Timestamp"
+	HeaderSignature = "Webhook-Signature"
+
+	signatureVersion = "v1="
+)
+
+// DefaultTolerance is how far a delivery's timestamp may be from the
+// receiver's clock.
+const DefaultTolerance = 5 * time.Minute
+
+var (
+	ErrMissingHeaders   = errors.New("Missing webhook headers.")
+	ErrInvalidTimestamp = errors.New("Invalid webhook timestamp.")
+	ErrExpired          = errors.New("Webhook timestamp outside tolerance.")
+	ErrInvalidSignature = errors.New("Invalid webhook signature.")
+)
+
+// Sign returns the signature for a delivery, in the form used in the
+// signature header.
+func Sign(secret, id string, timestamp time.Time, body []byte) string {
+	return signatureVersion + hex.EncodeToString(mac(secret, id, timestamp.Unix(), body))
+}
+
+// SetHeaders signs a delivery with each secret and sets the webhook headers.
+// Signing with more than one secret lets a receiver rotate keys.
+func SetHeaders(headers http.Header, secrets []string, id string, timestamp time.Time, body []byte) {
+	signatures := make([]string, len(secrets))
+	for i, secret := range secrets {
+		signatures[i] = Sign(secret, id, timestamp, body)
+	}
+	headers.Set(HeaderID, id)
+	headers.Set(HeaderTimestamp, strconv.FormatInt(timestamp.Unix(), 10))
+	headers.Set(HeaderSignature, strings.Join(signatures, " "))
+}
+
+// Verify checks the webhook headers against the raw body and returns the
+// delivery ID. The delivery is accepted if any signature in the header
+// matches any of the secrets.
+func Verify(headers http.Header, body []byte, secrets []string, tolerance time.Duration, now time.Time) (string, error) {
+	id := headers.Get(HeaderID)
+	timestampString := headers.Get(HeaderTimestamp)
+	signatureString := headers.Get(HeaderSignature)
+	if id == "" || timestampString == "" || signatureString == "" {
+		return "", ErrMissingHeaders
+	}
+	timestamp, err := strconv.ParseInt(timestampString, 10, 64)
+	if err != nil {
+		return "", ErrInvalidTimestamp
+	}
+	if diff := now.Sub(time.Unix(timestamp, 0)); diff > tolerance || diff < -tolerance {
+		return "", ErrExpired
+	}
+	for _, signature := range strings.Fields(signatureString) {
+		hexSignature, found := strings.CutPrefix(signature, signatureVersion)
+		if !found {
+			continue
+		}
+		decoded, err := hex.DecodeString(hexSignature)
+		if err != nil {
+			continue
+		}
+		for _, secret := range secrets {
+			if hmac.Equal(decoded, mac(secret, id, timestamp, body)) {
+				return id, nil
+			}
+		}
+	}
+	return "", ErrInvalidSignature
+}
+
+func mac(secret, id string, timestamp int64, body []byte) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(h, "%s.%d.", id, timestamp)
+	h.Write(body)
+	return h.Sum(nil)
+}
+
+// Backoff returns how long to wait before retry number attempt, starting at
+// base and doubling up to max.
+func Backoff(attempt int, base, max time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if delay >= max {
+			return max
+		}
+	}
+	return min(delay, max)
+}
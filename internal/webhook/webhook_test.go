@@ -0,0 +1,161 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+// TestVerify tests that a signed delivery verifies with any active secret
+func TestVerify(t *testing.T) {
+	now := time.Now()
+	body := []byte(`{"event":"user.upgraded"}`)
+	headers := http.Header{}
+	SetHeaders(headers, []string{"new-secret"}, "delivery-1", now, body)
+
+	id, err := Verify(headers, body, []string{"old-secret", "new-secret"}, DefaultTolerance, now)
+	if err != nil {
+		t.Fatalf("Error verifying webhook: %s", err)
+	}
+	if id != "delivery-1" {
+		t.Fatalf("Unexpected delivery ID: %s", id)
+	}
+}
+
+func TestVerifyRejectsTampering(t *testing.T) {
+	now := time.Now()
+	body := []byte(`{"event":"user.upgraded"}`)
+	headers := http.Header{}
+	SetHeaders(headers, []string{"secret"}, "delivery-1", now, body)
+
+	_, err := Verify(headers, []byte(`{"event":"user.downgraded"}`), []string{"secret"}, DefaultTolerance, now)
+	if !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("Expected invalid signature for changed body, got %v", err)
+	}
+	_, err = Verify(headers, body, []string{"other"}, DefaultTolerance, now)
+	if !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("Expected invalid signature for wrong secret, got %v", err)
+	}
+	headers.Set(HeaderID, "delivery-2")
+	_, err = Verify(headers, body, []string{"secret"}, DefaultTolerance, now)
+	if !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("Expected invalid signature for changed ID, got %v", err)
+	}
+}
+
+func TestVerifyTolerance(t *testing.T) {
+	sent := time.Now()
+	body := []byte(`{}`)
+	headers := http.Header{}
+	SetHeaders(headers, []string{"secret"}, "delivery-1", sent, body)
+
+	_, err := Verify(headers, body, []string{"secret"}, DefaultTolerance, sent.Add(DefaultTolerance+time.Second))
+	if !errors.Is(err, ErrExpired) {
+		t.Fatalf("Expected expired delivery, got %v", err)
+	}
+	_, err = Verify(headers, body, []string{"secret"}, DefaultTolerance, sent.Add(-DefaultTolerance-time.Second))
+	if !errors.Is(err, ErrExpired) {
+		t.Fatalf("Expected delivery from the future to be rejected, got %v", err)
+	}
+	headers.Del(HeaderSignature)
+	_, err = Verify(headers, body, []string{"secret"}, DefaultTolerance, sent)
+	if !errors.Is(err, ErrMissingHeaders) {
+		t.Fatalf("Expected missing headers, got %v", err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	delays := []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute, 10 * time.Minute, 10 * time.Minute}
+	for i, want := range delays {
+		if got := Backoff(i+1, time.Minute, 10*time.Minute); got != want {
+			t.Fatalf("Attempt %d: expected %s, got %s", i+1, want, got)
+		}
+	}
+}
+
+func TestClientSend(t *testing.T) {
+	body := []byte(`{"type":"chirp.created"}`)
+	received := make(chan string, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		got, err := io.ReadAll(req.Body)
+		if err != nil {
+			t.Errorf("Error reading body: %s", err)
+		}
+		id, err := Verify(req.Header, got, []string{"secret"}, DefaultTolerance, time.Now())
+		if err != nil {
+			w.WriteHeader(401)
+			return
+		}
+		received <- id
+		w.WriteHeader(204)
+	}))
+	defer receiver.Close()
+
+	client := NewClient(time.Second, "test", true)
+	status, err := client.Send(context.Background(), receiver.URL, "secret", "delivery-1", body)
+	if err != nil {
+		t.Fatalf("Error sending webhook: %s", err)
+	}
+	if status != 204 {
+		t.Fatalf("Unexpected status: %d", status)
+	}
+	if id := <-received; id != "delivery-1" {
+		t.Fatalf("Unexpected delivery ID: %s", id)
+	}
+
+	status, err = client.Send(context.Background(), receiver.URL, "wrong", "delivery-2", body)
+	if err == nil || status != 401 {
+		t.Fatalf("Expected rejected delivery, got status %d and error %v", status, err)
+	}
+}
+
+func TestClientBlocksPrivateAddresses(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		t.Errorf("Request reached a loopback receiver")
+	}))
+	defer receiver.Close()
+
+	client := NewClient(time.Second, "test", false)
+	_, err := client.Send(context.Background(), receiver.URL, "secret", "delivery-1", []byte(`{}`))
+	if !errors.Is(err, ErrBlockedAddress) {
+		t.Fatalf("Expected ErrBlockedAddress, got %v", err)
+	}
+	if err.Error() != ErrBlockedAddress.Error() {
+		t.Fatalf("Unexpected error message: %s", err)
+	}
+
+	for _, raw := range []string{"127.0.0.1", "10.1.2.3", "169.254.169.254", "::1", "::ffff:192.168.0.1", "0.0.0.0", "100.64.0.1"} {
+		if PublicAddr(netip.MustParseAddr(raw)) {
+			t.Fatalf("Expected %s to be refused", raw)
+		}
+	}
+	if !PublicAddr(netip.MustParseAddr("93.184.216.34")) {
+		t.Fatalf("Expected public address to be allowed")
+	}
+}
+
+func TestClientDoesNotFollowRedirects(t *testing.T) {
+	redirected := false
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/internal" {
+			redirected = true
+			return
+		}
+		http.Redirect(w, req, "/internal", http.StatusTemporaryRedirect)
+	}))
+	defer receiver.Close()
+
+	client := NewClient(time.Second, "test", true)
+	status, err := client.Send(context.Background(), receiver.URL, "secret", "delivery-1", []byte(`{}`))
+	if err == nil || status != http.StatusTemporaryRedirect {
+		t.Fatalf("Expected redirect to be returned, got status %d and error %v", status, err)
+	}
+	if redirected {
+		t.Fatalf("Redirect was followed")
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/curtisbraxdale/chirpy/internal/auth"
+	"github.com/google/uuid"
+)
+
+const headerRequestID = "X-Request-ID"
+
+// maxRequestIDLength bounds IDs taken from clients, which end up in every
+// log line for the request.
+const maxRequestIDLength = 128
+
+type loggerKey struct{}
+
+// requestLogger returns the logger for a request, which includes its request
+// ID and user, or the default logger outside a request.
+func requestLogger(req *http.Request) *slog.Logger {
+	return loggerFromContext(req.Context())
+}
+
+func loggerFromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// validRequestID accepts IDs from upstream proxies if they are short and
+// printable, so they can't forge log lines.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range []byte(id) {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// middlewareLogging gives each request an ID, keeping one set by a proxy,
+// puts a logger with the ID and user on the context, and logs the request
+// when it completes. The user comes from the access token alone; handlers
+// still do their own authentication.
+func (cfg *apiConfig) middlewareLogging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		requestID := req.Header.Get(headerRequestID)
+		if !validRequestID(requestID) {
+			requestID = uuid.NewString()
+		}
+		w.Header().Set(headerRequestID, requestID)
+
+		logger := slog.Default().With("request_id", requestID)
+		if token, err := auth.GetBearerToken(req.Header); err == nil {
+			if userID, err := auth.ValidateJWT(token, cfg.secret); err == nil {
+				logger = logger.With("user_id", userID)
+			}
+		}
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, req.WithContext(context.WithValue(req.Context(), loggerKey{}, logger)))
+
+		status := rec.status
+		if status == 0 {
+			status = 200
+		}
+		logger.Info("Request", "method", req.Method, "path", req.URL.Path, "status", status, "latency_ms", float64(time.Since(start).Microseconds())/1000)
+	})
+}
+
+// statusRecorder remembers the response status. It passes through flushing
+// and hijacking, which streams and websockets need.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = 200
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("Hijacking not supported")
+	}
+	// A hijacked connection is reported as switching protocols.
+	r.status = http.StatusSwitchingProtocols
+	return h.Hijack()
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -4,17 +4,32 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"regexp"
 	"sort"
-	"strings"
+	"strconv"
 	"sync/atomic"
+	"syscall"
 	"time"
 
+	"github.com/curtisbraxdale/chirpy/internal/audit"
 	"github.com/curtisbraxdale/chirpy/internal/auth"
+	"github.com/curtisbraxdale/chirpy/internal/config"
 	"github.com/curtisbraxdale/chirpy/internal/database"
+	"github.com/curtisbraxdale/chirpy/internal/dedupe"
+	"github.com/curtisbraxdale/chirpy/internal/entitlements"
+	"github.com/curtisbraxdale/chirpy/internal/filter"
+	"github.com/curtisbraxdale/chirpy/internal/notify"
+	"github.com/curtisbraxdale/chirpy/internal/pubsub"
+	"github.com/curtisbraxdale/chirpy/internal/storage"
+	"github.com/curtisbraxdale/chirpy/internal/textlen"
+	"github.com/curtisbraxdale/chirpy/internal/webhook"
 	"github.com/google/uuid"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
@@ -22,23 +37,73 @@ import (
 
 func main() {
 	godotenv.Load()
-	dbURL := os.Getenv("DB_URL")
-	platform := os.Getenv("PLATFORM")
-	secret := os.Getenv("TOKEN_SECRET")
-	polkaKey := os.Getenv("POLKA_KEY")
-	db, err := sql.Open("postgres", dbURL)
+	conf, err := config.Load(os.Args[1:])
 	if err != nil {
-		log.Printf("Error connecting to database: %s", err)
+		log.Fatalf("Invalid configuration:\n%s", err)
+	}
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: conf.LogLevel})))
+	slog.Info("Configuration", "config", conf.Redacted())
+	filterConfigRules := []filter.Rule{}
+	if conf.ContentFilterFile != "" {
+		f, err := os.Open(conf.ContentFilterFile)
+		if err != nil {
+			slog.Error("Error opening content filter file", "error", err)
+			os.Exit(1)
+		}
+		filterConfigRules, err = filter.ParseRules(f)
+		f.Close()
+		if err != nil {
+			slog.Error("Error reading content filter file", "error", err)
+			os.Exit(1)
+		}
+	}
+	db, err := sql.Open("postgres", conf.DBURL)
+	if err != nil {
+		slog.Error("Error connecting to database", "error", err)
+		os.Exit(1)
+	}
+	pingCtx, cancelPing := context.WithTimeout(context.Background(), 10*time.Second)
+	err = db.PingContext(pingCtx)
+	cancelPing()
+	if err != nil {
+		slog.Error("Error connecting to database", "error", err)
+		os.Exit(1)
 	}
 	dbQueries := database.New(db)
 
 	serveMux := http.NewServeMux()
-	apiCfg := apiConfig{queries: dbQueries, platform: platform, secret: secret, polkaKey: polkaKey}
+	broker := pubsub.NewBroker(conf.DBURL, dbQueries)
+	notifier := notify.NewService(dbQueries, func(ctx context.Context, n database.Notification) {
+		err := broker.Publish(ctx, pubsub.Notification, n.UserID, newNotification(n))
+		if err != nil {
+			slog.Error("Error publishing notification", "error", err)
+		}
+	})
+	workers := newWorkerGroup()
+	workers.Go(func(ctx context.Context) {
+		err := broker.Run(ctx)
+		if err != nil {
+			slog.Error("Error running stream broker", "error", err)
+		}
+	})
+	store := newStore(conf.Media)
+	apiCfg := apiConfig{db: db, queries: dbQueries, notifier: notifier, broker: broker, store: store, filter: filter.NewEngine(filterConfigRules), filterConfigRules: filterConfigRules, restoreWindow: conf.RestoreWindow, duplicateWindow: conf.DuplicateWindow, platform: conf.Platform, allowedOrigins: conf.AllowedOrigins, secret: conf.TokenSecret, accessTokenTTL: conf.AccessTokenTTL, refreshTokenTTL: conf.RefreshTokenTTL, polkaSecrets: conf.PolkaSecrets, polkaTolerance: conf.PolkaTolerance, webhookClient: webhook.NewClient(deliveryTimeout, "Chirpy-Webhooks/1.0", conf.Platform == "dev"), metrics: newMetrics(db), metricsToken: conf.MetricsToken, shutdown: make(chan struct{})}
+	err = apiCfg.reloadFilter()
+	if err != nil {
+		slog.Error("Error loading content filter rules", "error", err)
+	}
+	workers.Go(apiCfg.runFilterReload)
+	workers.Go(apiCfg.runScheduler)
+	workers.Go(apiCfg.runTrashPurge)
+	workers.Go(apiCfg.runSubscriptionExpiry)
+	workers.Go(apiCfg.runWebhookInbox)
+	workers.Go(apiCfg.runWebhookDeliveries)
 	fileHandler := http.StripPrefix("/app/", http.FileServer(http.Dir(".")))
 
 	serveMux.Handle("/app/", apiCfg.middlewareMetricsInc(fileHandler))
-	serveMux.HandleFunc("GET /api/healthz", readiHandler)
+	serveMux.HandleFunc("GET /api/healthz", apiCfg.readiHandler)
 	serveMux.HandleFunc("GET /admin/metrics", apiCfg.hitsHandler)
+	serveMux.Handle("GET /metrics", apiCfg.metricsHandler())
 	serveMux.HandleFunc("POST /admin/reset", apiCfg.resetHandler)
 	serveMux.HandleFunc("POST /api/users", apiCfg.createUserHandler)
 	serveMux.HandleFunc("POST /api/chirps", apiCfg.createChirpHandler)
@@ -50,16 +115,87 @@ func main() {
 	serveMux.HandleFunc("POST /api/revoke", apiCfg.revokeHandler)
 	serveMux.HandleFunc("PUT /api/users", apiCfg.updateUserHandler)
 	serveMux.HandleFunc("POST /api/polka/webhooks", apiCfg.polkaWebHookHandler)
+	serveMux.HandleFunc("GET /api/search", apiCfg.searchChirpsHandler)
+	serveMux.HandleFunc("GET /api/search/users", apiCfg.searchUsersHandler)
+	serveMux.HandleFunc("POST /api/users/{userID}/block", apiCfg.blockHandler)
+	serveMux.HandleFunc("DELETE /api/users/{userID}/block", apiCfg.unblockHandler)
+	serveMux.HandleFunc("GET /api/users/me/blocks", apiCfg.listBlocksHandler)
+	serveMux.HandleFunc("POST /api/users/{userID}/mute", apiCfg.muteHandler)
+	serveMux.HandleFunc("DELETE /api/users/{userID}/mute", apiCfg.unmuteHandler)
+	serveMux.HandleFunc("GET /api/users/me/mutes", apiCfg.listMutesHandler)
+	serveMux.HandleFunc("GET /api/notifications", apiCfg.getNotificationsHandler)
+	serveMux.HandleFunc("POST /api/notifications/{notificationID}/read", apiCfg.readNotificationHandler)
+	serveMux.HandleFunc("POST /api/notifications/read", apiCfg.readAllNotificationsHandler)
+	serveMux.HandleFunc("GET /api/stream", apiCfg.streamHandler)
+	serveMux.HandleFunc("GET /api/ws", apiCfg.websocketHandler)
+	serveMux.HandleFunc("POST /api/conversations", apiCfg.createConversationHandler)
+	serveMux.HandleFunc("GET /api/conversations", apiCfg.listConversationsHandler)
+	serveMux.HandleFunc("GET /api/conversations/{conversationID}/messages", apiCfg.listMessagesHandler)
+	serveMux.HandleFunc("POST /api/conversations/{conversationID}/messages", apiCfg.createMessageHandler)
+	serveMux.HandleFunc("POST /api/conversations/{conversationID}/read", apiCfg.readConversationHandler)
+	serveMux.HandleFunc("POST /api/media", apiCfg.uploadMediaHandler)
+	serveMux.HandleFunc("POST /api/polls/{pollID}/vote", apiCfg.votePollHandler)
+	serveMux.HandleFunc("POST /api/drafts", apiCfg.createDraftHandler)
+	serveMux.HandleFunc("GET /api/drafts", apiCfg.listDraftsHandler)
+	serveMux.HandleFunc("GET /api/drafts/{draftID}", apiCfg.getDraftHandler)
+	serveMux.HandleFunc("PUT /api/drafts/{draftID}", apiCfg.updateDraftHandler)
+	serveMux.HandleFunc("DELETE /api/drafts/{draftID}", apiCfg.deleteDraftHandler)
+	serveMux.HandleFunc("GET /api/chirps/scheduled", apiCfg.listScheduledHandler)
+	serveMux.HandleFunc("GET /api/users/me/trash", apiCfg.listTrashHandler)
+	serveMux.HandleFunc("POST /api/chirps/{chirpID}/restore", apiCfg.restoreChirpHandler)
+	serveMux.HandleFunc("GET /admin/filter/rules", apiCfg.listFilterRulesHandler)
+	serveMux.HandleFunc("POST /admin/filter/rules", apiCfg.createFilterRuleHandler)
+	serveMux.HandleFunc("DELETE /admin/filter/rules/{ruleID}", apiCfg.deleteFilterRuleHandler)
+	serveMux.HandleFunc("GET /admin/filter/flags", apiCfg.listContentFlagsHandler)
+	serveMux.HandleFunc("POST /api/reports", apiCfg.createReportHandler)
+	serveMux.HandleFunc("GET /api/moderation/reports", apiCfg.listReportsHandler)
+	serveMux.HandleFunc("POST /api/moderation/actions", apiCfg.moderationActionHandler)
+	serveMux.HandleFunc("GET /api/moderation/actions", apiCfg.listModerationActionsHandler)
+	serveMux.HandleFunc("GET /admin/audit", apiCfg.listAuditEventsHandler)
+	serveMux.HandleFunc("GET /admin/webhooks/events", apiCfg.listWebhookEventsHandler)
+	serveMux.HandleFunc("POST /admin/webhooks/events/{eventID}/replay", apiCfg.replayWebhookEventHandler)
+	serveMux.HandleFunc("POST /api/webhooks", apiCfg.createWebhookEndpointHandler)
+	serveMux.HandleFunc("GET /api/webhooks", apiCfg.listWebhookEndpointsHandler)
+	serveMux.HandleFunc("DELETE /api/webhooks/{endpointID}", apiCfg.deleteWebhookEndpointHandler)
+	serveMux.HandleFunc("POST /api/webhooks/{endpointID}/enable", apiCfg.enableWebhookEndpointHandler)
+	serveMux.HandleFunc("POST /api/webhooks/{endpointID}/test", apiCfg.testWebhookEndpointHandler)
+	serveMux.HandleFunc("GET /api/webhooks/{endpointID}/deliveries", apiCfg.listWebhookDeliveriesHandler)
+	if local, ok := store.(storage.Local); ok {
+		serveMux.Handle("/media/", http.StripPrefix("/media/", http.FileServer(local.FileSystem())))
+	}
 
-	server := http.Server{}
-	server.Handler = serveMux
-	server.Addr = ":8080"
+	server := http.Server{
+		Addr:              conf.Addr,
+		Handler:           apiCfg.middlewareLogging(apiCfg.middlewareMetrics(serveMux)),
+		ReadHeaderTimeout: conf.ReadHeaderTimeout,
+		ReadTimeout:       conf.ReadTimeout,
+		WriteTimeout:      conf.WriteTimeout,
+		IdleTimeout:       conf.IdleTimeout,
+	}
 
-	log.Fatal(server.ListenAndServe())
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		err := server.ListenAndServe()
+		if !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Error running server", "error", err)
+			os.Exit(1)
+		}
+	}()
+	<-ctx.Done()
+	// A second signal kills the process straight away.
+	stop()
+	apiCfg.shutdownServer(&server, workers, conf.DrainDelay, conf.ShutdownTimeout)
 }
 
-func readiHandler(w http.ResponseWriter, req *http.Request) {
+// readiHandler fails once shutdown has started, so load balancers stop
+// sending new requests while in-flight ones finish.
+func (cfg *apiConfig) readiHandler(w http.ResponseWriter, req *http.Request) {
 	w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+	if cfg.draining.Load() {
+		w.WriteHeader(503)
+		w.Write([]byte("Shutting down"))
+		return
+	}
 	w.WriteHeader(200)
 	w.Write([]byte("OK"))
 }
@@ -67,7 +203,7 @@ func readiHandler(w http.ResponseWriter, req *http.Request) {
 func (apiCfg *apiConfig) hitsHandler(w http.ResponseWriter, req *http.Request) {
 	w.Header().Add("Content-Type", "text/html")
 	w.WriteHeader(200)
-	hitString := fmt.Sprintf("<html><body><h1>Welcome, Chirpy Admin</h1><p>Chirpy has been visited %d times!</p></body></html>", apiCfg.fileserverHits.Load())
+	hitString := fmt.Sprintf("<html><body><h1>Welcome, Chirpy Admin</h1><p>Chirpy has been visited %d times!</p></body></html>", apiCfg.metrics.hits())
 	w.Write([]byte(hitString))
 }
 
@@ -75,13 +211,14 @@ func (apiCfg *apiConfig) resetHandler(w http.ResponseWriter, req *http.Request)
 	if apiCfg.platform != "dev" {
 		w.WriteHeader(403)
 	} else {
-		apiCfg.fileserverHits.Store(0)
+		apiCfg.metrics.resetHits()
 		err := apiCfg.queries.DeleteUsers(context.Background())
 		if err != nil {
-			log.Printf("Error deleting users: %s", err)
+			requestLogger(req).Error("Error deleting users", "error", err)
 			w.WriteHeader(500)
 			return
 		}
+		apiCfg.recordAudit(req.Context(), requestAuditEvent(req, audit.ActionAdminReset))
 		w.Header().Add("Content-Type", "text/plain; charset=utf-8")
 		w.WriteHeader(200)
 		w.Write([]byte("Deleted Users & Hits Reset."))
@@ -89,16 +226,38 @@ func (apiCfg *apiConfig) resetHandler(w http.ResponseWriter, req *http.Request)
 }
 
 type apiConfig struct {
-	fileserverHits atomic.Int32
-	queries        *database.Queries
-	platform       string
-	secret         string
-	polkaKey       string
+	db       *sql.DB
+	queries  *database.Queries
+	notifier *notify.Service
+	broker   *pubsub.Broker
+	store    storage.Store
+	filter   *filter.Engine
+	// filterConfigRules come from CONTENT_FILTER_FILE and are always applied
+	// alongside the rules in the database.
+	filterConfigRules []filter.Rule
+	restoreWindow     time.Duration
+	// duplicateWindow is how long an author has to wait before posting the
+	// same text again. Zero turns the check off.
+	duplicateWindow time.Duration
+	platform        string
+	allowedOrigins  []string
+	secret          string
+	accessTokenTTL  time.Duration
+	refreshTokenTTL time.Duration
+	polkaSecrets    []string
+	polkaTolerance  time.Duration
+	webhookClient   *webhook.Client
+	metrics         *metrics
+	metricsToken    string
+	// draining is set when shutdown starts, and shutdown is closed once the
+	// server stops accepting connections, to end long-lived streams.
+	draining atomic.Bool
+	shutdown chan struct{}
 }
 
 func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		cfg.fileserverHits.Add(1)
+		cfg.metrics.fileserverHits.Inc()
 		next.ServeHTTP(w, r)
 	})
 }
@@ -110,7 +269,7 @@ func respondWithError(w http.ResponseWriter, code int, msg string) {
 	respBody := errorValues{Error: msg}
 	dat, err := json.Marshal(respBody)
 	if err != nil {
-		log.Printf("Error marshalling JSON: %s", err)
+		slog.Error("Error marshalling JSON", "error", err)
 		w.WriteHeader(500)
 		return
 	}
@@ -119,10 +278,29 @@ func respondWithError(w http.ResponseWriter, code int, msg string) {
 	w.Write(dat)
 }
 
+// FieldError describes one invalid field in a request.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Length  int    `json:"length,omitempty"`
+	Limit   int    `json:"limit,omitempty"`
+}
+
+// respondWithValidationError reports every invalid field, using the first
+// one's message as the error.
+func respondWithValidationError(w http.ResponseWriter, code int, details []FieldError) {
+	type errorValues struct {
+		Error   string       `json:"error"`
+		Details []FieldError `json:"details"`
+	}
+	respondWithJSON(w, code, errorValues{Error: details[0].Message, Details: details})
+}
+
 func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	dat, err := json.Marshal(payload)
 	if err != nil {
-		log.Printf("Error marshalling JSON: %s", err)
+		slog.Error("Error marshalling JSON", "error", err)
 		w.WriteHeader(500)
 		return
 	}
@@ -131,128 +309,394 @@ func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	w.Write(dat)
 }
 
-func cleanChirp(body string) string {
-	splitWords := strings.Split(body, " ")
-	for i, word := range splitWords {
-		if strings.ToLower(word) == "kerfuffle" || strings.ToLower(word) == "sharbert" || strings.ToLower(word) == "fornax" {
-			splitWords[i] = "****"
+// authenticatedUserID validates the bearer JWT on the request and returns the
+// user it was issued to.
+func (cfg *apiConfig) authenticatedUserID(req *http.Request) (uuid.UUID, error) {
+	token, err := auth.GetBearerToken(req.Header)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return cfg.validateToken(token)
+}
+
+// validateToken validates a JWT and rejects it if its user is suspended, so
+// existing tokens stop working as soon as a moderator acts.
+func (cfg *apiConfig) validateToken(token string) (uuid.UUID, error) {
+	userID, err := auth.ValidateJWT(token, cfg.secret)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	suspended, err := cfg.queries.IsSuspended(context.Background(), userID)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("%w: %w", errAuthUnavailable, err)
+	}
+	if suspended {
+		return uuid.Nil, errSuspended
+	}
+	return userID, nil
+}
+
+// errAuthUnavailable wraps failures to check a token that aren't the
+// caller's fault, like the database being down.
+var errAuthUnavailable = errors.New("Error checking token")
+
+// respondAuthError writes 500 if the token couldn't be checked, and 401 if it
+// was rejected.
+func respondAuthError(w http.ResponseWriter, req *http.Request, err error) {
+	if errors.Is(err, errAuthUnavailable) {
+		requestLogger(req).Error("Error validating token", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	requestLogger(req).Warn("Invalid token", "error", err)
+	w.WriteHeader(401)
+}
+
+const roleAdmin = "admin"
+
+// requireRole authenticates the caller and checks they hold one of the roles,
+// writing 401 or 403 if not.
+func (cfg *apiConfig) requireRole(w http.ResponseWriter, req *http.Request, roles ...string) (uuid.UUID, bool) {
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		respondAuthError(w, req, err)
+		return uuid.Nil, false
+	}
+	hasRole, err := cfg.queries.HasRole(context.Background(), database.HasRoleParams{UserID: userID, Roles: roles})
+	if err != nil {
+		requestLogger(req).Error("Error checking role", "error", err)
+		w.WriteHeader(500)
+		return uuid.Nil, false
+	}
+	if !hasRole {
+		w.WriteHeader(403)
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+// optionalUserID is for endpoints that also serve anonymous readers. A missing
+// or invalid token is treated as no viewer.
+func (cfg *apiConfig) optionalUserID(req *http.Request) uuid.NullUUID {
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		return uuid.NullUUID{}
+	}
+	return uuid.NullUUID{UUID: userID, Valid: true}
+}
+
+// parsePagination reads the limit and offset query parameters, defaulting to
+// the first page and capping the page size.
+func parsePagination(req *http.Request) (int32, int32, error) {
+	limit, offset := int32(defaultPageSize), int32(0)
+	if limitString := req.URL.Query().Get("limit"); limitString != "" {
+		parsed, err := strconv.ParseInt(limitString, 10, 32)
+		if err != nil || parsed < 1 {
+			return 0, 0, errors.New("Invalid limit")
+		}
+		limit = int32(min(parsed, maxPageSize))
+	}
+	if offsetString := req.URL.Query().Get("offset"); offsetString != "" {
+		parsed, err := strconv.ParseInt(offsetString, 10, 32)
+		if err != nil || parsed < 0 {
+			return 0, 0, errors.New("Invalid offset")
 		}
+		offset = int32(parsed)
+	}
+	return limit, offset, nil
+}
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+var (
+	errDuplicateChirp = errors.New("You already posted this chirp recently")
+	errRejectedChirp  = errors.New("Chirp contains prohibited content")
+)
+
+const (
+	chirpLimit = 140
+	// longChirpLimit is the limit for plans with entitlements.ChirpLong.
+	longChirpLimit = 280
+)
+
+// validateChirpBody checks the body against the author's length limit,
+// counting what readers see rather than bytes.
+func validateChirpBody(body string, ents entitlements.Entitlements) *FieldError {
+	limit := chirpLimit
+	if ents.Can(entitlements.ChirpLong) {
+		limit = longChirpLimit
+	}
+	if length := textlen.Count(body); length > limit {
+		return &FieldError{Field: "body", Code: "too_long", Message: "Chirp is too long", Length: length, Limit: limit}
+	}
+	return nil
+}
+
+// entitlements returns what the user's current plan allows.
+func (cfg *apiConfig) entitlements(userID uuid.UUID) (entitlements.Entitlements, error) {
+	isChirpyRed, err := cfg.queries.IsChirpyRed(context.Background(), userID)
+	if err != nil {
+		return entitlements.Entitlements{}, err
 	}
-	cleanedBody := strings.Join(splitWords, " ")
-	return cleanedBody
+	if isChirpyRed {
+		return entitlements.For(entitlements.PlanChirpyRed), nil
+	}
+	return entitlements.For(entitlements.PlanFree), nil
 }
 
 func (cfg *apiConfig) createUserHandler(w http.ResponseWriter, req *http.Request) {
 	type parameters struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Email       string `json:"email"`
+		Password    string `json:"password"`
+		Handle      string `json:"handle"`
+		DisplayName string `json:"display_name"`
 	}
 	decoder := json.NewDecoder(req.Body)
 	params := parameters{}
 	err := decoder.Decode(&params)
 	if err != nil {
-		log.Printf("Error decoding parameters: %s", err)
+		requestLogger(req).Error("Error decoding parameters", "error", err)
 		w.WriteHeader(500)
 		return
 	}
+	if params.Handle != "" && !validHandle.MatchString(params.Handle) {
+		respondWithError(w, 400, "Handle must be 1-30 letters, digits or underscores")
+		return
+	}
 	hashedPassword, err := auth.HashPassword(params.Password)
 	if err != nil {
-		log.Printf("Error hashing password: %s", err)
+		requestLogger(req).Error("Error hashing password", "error", err)
 		w.WriteHeader(500)
 		return
 	}
-	dbUserParams := database.CreateUserParams{Email: params.Email, HashedPassword: hashedPassword}
+	dbUserParams := database.CreateUserParams{Email: params.Email, HashedPassword: hashedPassword, Handle: sql.NullString{String: params.Handle, Valid: params.Handle != ""}, DisplayName: params.DisplayName}
 	dbUser, err := cfg.queries.CreateUser(context.Background(), dbUserParams)
 	if err != nil {
-		log.Printf("Error creating user: %s", err)
+		requestLogger(req).Error("Error creating user", "error", err)
 		w.WriteHeader(500)
 		return
 	}
-	newUser := User{ID: dbUser.ID, CreatedAt: dbUser.CreatedAt, UpdatedAt: dbUser.UpdatedAt, Email: dbUser.Email, IsChirpyRed: dbUser.IsChirpyRed.Bool}
+	newUser := User{ID: dbUser.ID, CreatedAt: dbUser.CreatedAt, UpdatedAt: dbUser.UpdatedAt, Email: dbUser.Email, Handle: dbUser.Handle.String, DisplayName: dbUser.DisplayName}
 	respondWithJSON(w, 201, newUser)
 }
 
+var validHandle = regexp.MustCompile(`^[A-Za-z0-9_]{1,30}$`)
+
 type User struct {
 	ID           uuid.UUID `json:"id"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 	Email        string    `json:"email"`
+	Handle       string    `json:"handle"`
+	DisplayName  string    `json:"display_name"`
 	Token        string    `json:"token"`
 	RefreshToken string    `json:"refresh_token"`
 	IsChirpyRed  bool      `json:"is_chirpy_red"`
+	// Entitlements is only included in the login response.
+	Entitlements *entitlements.Entitlements `json:"entitlements,omitempty"`
 }
 
 func (cfg *apiConfig) createChirpHandler(w http.ResponseWriter, req *http.Request) {
 	type parameters struct {
-		Body string `json:"body"`
+		Body     string          `json:"body"`
+		MediaIDs []uuid.UUID     `json:"media_ids"`
+		Poll     *pollParameters `json:"poll"`
 	}
 	decoder := json.NewDecoder(req.Body)
 	params := parameters{}
 	err := decoder.Decode(&params)
 	if err != nil {
-		log.Printf("Error decoding parameters: %s", err)
+		requestLogger(req).Error("Error decoding parameters", "error", err)
 		w.WriteHeader(500)
 		return
 	}
 	// Checking User Tokens
 	token, err := auth.GetBearerToken(req.Header)
 	if err != nil {
-		log.Printf("Error getting bearer token: %s", err)
+		requestLogger(req).Warn("Error getting bearer token", "error", err)
 		w.WriteHeader(401)
 		return
 	}
-	validUserID, err := auth.ValidateJWT(token, cfg.secret)
+	validUserID, err := cfg.validateToken(token)
 	if err != nil {
-		log.Printf("Error validating jwt: %s", err)
-		w.WriteHeader(401)
+		respondAuthError(w, req, err)
+		return
+	}
+	ents, err := cfg.entitlements(validUserID)
+	if err != nil {
+		requestLogger(req).Error("Error getting entitlements", "error", err)
+		w.WriteHeader(500)
 		return
 	}
 	// Validate & Censor Chirp
-	if len(params.Body) > 140 {
-		respondWithError(w, 400, "Chirp is too long")
+	details := []FieldError{}
+	if fieldErr := validateChirpBody(params.Body, ents); fieldErr != nil {
+		details = append(details, *fieldErr)
+	}
+	if len(params.MediaIDs) > ents.MediaPerChirp {
+		details = append(details, FieldError{Field: "media_ids", Code: "too_many", Message: "Too many media attachments", Length: len(params.MediaIDs), Limit: ents.MediaPerChirp})
+	}
+	if msg := validatePoll(params.Poll, time.Now()); msg != "" {
+		details = append(details, FieldError{Field: "poll", Code: "invalid", Message: msg})
+	}
+	if len(details) > 0 {
+		respondWithValidationError(w, 400, details)
 	} else {
-		cleanedBody := cleanChirp(params.Body)
-		chirpParams := database.CreateChirpParams{Body: cleanedBody, UserID: validUserID}
-		dbChirp, err := cfg.queries.CreateChirp(context.Background(), chirpParams)
+		chirpParams := database.CreateChirpParams{Body: params.Body, UserID: validUserID}
+		dbChirp, err := cfg.createChirp(chirpParams, params.MediaIDs, params.Poll)
+		if errors.Is(err, errRejectedChirp) {
+			respondWithError(w, 400, errRejectedChirp.Error())
+			return
+		}
+		if errors.Is(err, errInvalidMedia) {
+			respondWithError(w, 400, "Invalid media")
+			return
+		}
+		if errors.Is(err, errDuplicateChirp) {
+			respondWithError(w, 409, errDuplicateChirp.Error())
+			return
+		}
+		if err != nil {
+			requestLogger(req).Error("Error creating chirp", "error", err)
+			w.WriteHeader(500)
+			return
+		}
+		newChirp, err := cfg.publishNewChirp(req.Context(), dbChirp)
 		if err != nil {
-			log.Printf("Error creating user: %s", err)
+			requestLogger(req).Error("Error getting chirp details", "error", err)
 			w.WriteHeader(500)
 			return
 		}
-		newChirp := Chirp{ID: dbChirp.ID, CreatedAt: dbChirp.CreatedAt, UpdatedAt: dbChirp.UpdatedAt, Body: dbChirp.Body, UserID: dbChirp.UserID}
 		respondWithJSON(w, 201, newChirp)
 	}
 }
 
+// createChirp inserts the chirp with its media and poll in one transaction.
+func (cfg *apiConfig) createChirp(chirpParams database.CreateChirpParams, mediaIDs []uuid.UUID, poll *pollParameters) (database.Chirp, error) {
+	tx, err := cfg.db.Begin()
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	defer tx.Rollback()
+	dbChirp, err := cfg.insertChirp(cfg.queries.WithTx(tx), chirpParams, mediaIDs, poll)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	return dbChirp, tx.Commit()
+}
+
+// insertChirp runs a validated chirp through the content filter and writes
+// it with its media and poll using the caller's transaction. It returns
+// errRejectedChirp if a filter rule rejects it, and errDuplicateChirp if the
+// author posted the same text within the duplicate window.
+func (cfg *apiConfig) insertChirp(q *database.Queries, chirpParams database.CreateChirpParams, mediaIDs []uuid.UUID, poll *pollParameters) (database.Chirp, error) {
+	filtered := cfg.filter.Apply(chirpParams.Body)
+	if filtered.Rejected {
+		return database.Chirp{}, errRejectedChirp
+	}
+	chirpParams.Body = filtered.Body
+	chirpParams.BodyHash = sql.NullString{String: dedupe.Hash(chirpParams.Body), Valid: true}
+	if cfg.duplicateWindow > 0 {
+		err := q.LockAuthorChirps(context.Background(), chirpParams.UserID.String())
+		if err != nil {
+			return database.Chirp{}, err
+		}
+		duplicate, err := q.HasRecentDuplicate(context.Background(), database.HasRecentDuplicateParams{
+			UserID:        chirpParams.UserID,
+			BodyHash:      chirpParams.BodyHash,
+			WindowSeconds: int64(cfg.duplicateWindow.Seconds()),
+		})
+		if err != nil {
+			return database.Chirp{}, err
+		}
+		if duplicate {
+			return database.Chirp{}, errDuplicateChirp
+		}
+	}
+	dbChirp, err := q.CreateChirp(context.Background(), chirpParams)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	if filtered.Flagged {
+		err = q.CreateContentFlag(context.Background(), database.CreateContentFlagParams{ChirpID: dbChirp.ID, Terms: filtered.Matches})
+		if err != nil {
+			return database.Chirp{}, err
+		}
+	}
+	err = attachMedia(q, dbChirp.ID, chirpParams.UserID, mediaIDs)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	if poll != nil {
+		err = createPoll(q, dbChirp.ID, *poll)
+		if err != nil {
+			return database.Chirp{}, err
+		}
+	}
+	return dbChirp, nil
+}
+
+// publishNewChirp loads the details of a committed chirp and sends it to the
+// live stream. Failures to publish are logged with ctx's logger.
+func (cfg *apiConfig) publishNewChirp(ctx context.Context, dbChirp database.Chirp) (Chirp, error) {
+	cfg.metrics.chirpsCreated.Inc()
+	chirps := []Chirp{{ID: dbChirp.ID, CreatedAt: dbChirp.CreatedAt, UpdatedAt: dbChirp.UpdatedAt, Body: dbChirp.Body, UserID: dbChirp.UserID}}
+	err := cfg.loadChirpDetails(chirps, uuid.NullUUID{UUID: dbChirp.UserID, Valid: true})
+	if err != nil {
+		return Chirp{}, err
+	}
+	err = cfg.broker.Publish(context.Background(), pubsub.ChirpCreated, dbChirp.UserID, chirps[0])
+	if err != nil {
+		loggerFromContext(ctx).Error("Error publishing chirp", "error", err)
+	}
+	cfg.queueWebhookEvent(ctx, dbChirp.UserID, eventChirpCreated, chirps[0])
+	return chirps[0], nil
+}
+
 type Chirp struct {
 	ID        uuid.UUID `json:"id"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 	Body      string    `json:"body"`
 	UserID    uuid.UUID `json:"user_id"`
+	Media     []Media   `json:"media"`
+	Poll      *Poll     `json:"poll"`
+}
+
+// loadChirpDetails fills in the media and polls on a page of chirps.
+func (cfg *apiConfig) loadChirpDetails(chirps []Chirp, viewerID uuid.NullUUID) error {
+	err := cfg.loadChirpMedia(chirps)
+	if err != nil {
+		return err
+	}
+	return cfg.loadChirpPolls(chirps, viewerID)
 }
 
 func (cfg *apiConfig) getChirpsHandler(w http.ResponseWriter, req *http.Request) {
 	userIDString := req.URL.Query().Get("author_id")
+	viewerID := cfg.optionalUserID(req)
 	dbChirps := []database.Chirp{}
 	var err error = nil
 	if userIDString == "" {
-		dbChirps, err = cfg.queries.GetChirps(context.Background())
+		dbChirps, err = cfg.queries.GetChirps(context.Background(), viewerID)
 		if err != nil {
-			log.Printf("Error getting chirps: %s", err)
+			requestLogger(req).Error("Error getting chirps", "error", err)
 			w.WriteHeader(500)
 			return
 		}
 	} else {
 		userID, err := uuid.Parse(userIDString)
 		if err != nil {
-			log.Printf("Error parsing UUID: %s", err)
+			requestLogger(req).Error("Error parsing UUID", "error", err)
 			w.WriteHeader(500)
 			return
 		}
-		dbChirps, err = cfg.queries.GetChirpsByUser(context.Background(), userID)
+		dbChirps, err = cfg.queries.GetChirpsByUser(context.Background(), database.GetChirpsByUserParams{UserID: userID, ViewerID: viewerID})
 		if err != nil {
-			log.Printf("Error getting chirps: %s", err)
+			requestLogger(req).Error("Error getting chirps", "error", err)
 			w.WriteHeader(500)
 			return
 		}
@@ -262,6 +706,12 @@ func (cfg *apiConfig) getChirpsHandler(w http.ResponseWriter, req *http.Request)
 	for _, c := range dbChirps {
 		chirps = append(chirps, Chirp{ID: c.ID, CreatedAt: c.CreatedAt, UpdatedAt: c.UpdatedAt, Body: c.Body, UserID: c.UserID})
 	}
+	err = cfg.loadChirpDetails(chirps, viewerID)
+	if err != nil {
+		requestLogger(req).Error("Error getting chirp details", "error", err)
+		w.WriteHeader(500)
+		return
+	}
 	sortDir := req.URL.Query().Get("sort")
 	if sortDir == "desc" {
 		sort.Slice(chirps, func(i, j int) bool { return chirps[j].CreatedAt.Before(chirps[i].CreatedAt) })
@@ -272,18 +722,38 @@ func (cfg *apiConfig) getChirpsHandler(w http.ResponseWriter, req *http.Request)
 func (cfg *apiConfig) getChirpHandler(w http.ResponseWriter, req *http.Request) {
 	chirpID, err := uuid.Parse(req.PathValue("chirpID"))
 	if err != nil {
-		log.Printf("Error parsing uuid: %s", err)
+		requestLogger(req).Error("Error parsing uuid", "error", err)
 		w.WriteHeader(500)
 		return
 	}
 	dbChirp, err := cfg.queries.GetChirp(context.Background(), chirpID)
 	if err != nil {
-		log.Printf("Chirp not found: %s", err)
+		requestLogger(req).Warn("Chirp not found", "error", err)
 		w.WriteHeader(404)
 		return
 	}
-	chirp := Chirp{ID: dbChirp.ID, CreatedAt: dbChirp.CreatedAt, UpdatedAt: dbChirp.UpdatedAt, Body: dbChirp.Body, UserID: dbChirp.UserID}
-	respondWithJSON(w, 200, chirp)
+	// Blocked authors and viewers can't see each other's chirps.
+	viewerID := cfg.optionalUserID(req)
+	if viewerID.Valid {
+		blocked, err := cfg.queries.HasBlock(context.Background(), database.HasBlockParams{BlockerID: viewerID.UUID, BlockedID: dbChirp.UserID})
+		if err != nil {
+			requestLogger(req).Error("Error checking blocks", "error", err)
+			w.WriteHeader(500)
+			return
+		}
+		if blocked {
+			w.WriteHeader(404)
+			return
+		}
+	}
+	chirps := []Chirp{{ID: dbChirp.ID, CreatedAt: dbChirp.CreatedAt, UpdatedAt: dbChirp.UpdatedAt, Body: dbChirp.Body, UserID: dbChirp.UserID}}
+	err = cfg.loadChirpDetails(chirps, viewerID)
+	if err != nil {
+		requestLogger(req).Error("Error getting chirp details", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	respondWithJSON(w, 200, chirps[0])
 }
 
 func (cfg *apiConfig) loginHandler(w http.ResponseWriter, req *http.Request) {
@@ -295,44 +765,79 @@ func (cfg *apiConfig) loginHandler(w http.ResponseWriter, req *http.Request) {
 	params := parameters{}
 	err := decoder.Decode(&params)
 	if err != nil {
-		log.Printf("Error decoding parameters: %s", err)
+		requestLogger(req).Error("Error decoding parameters", "error", err)
 		w.WriteHeader(500)
 		return
 	}
+	// Failed attempts are logged against the email, since there may be no
+	// such user.
+	failure := requestAuditEvent(req, audit.ActionLoginFailed)
+	failure.TargetType, failure.TargetID = "email", params.Email
 	dbUser, err := cfg.queries.GetUserByEmail(context.Background(), params.Email)
 	if err != nil {
-		log.Print("Incorrect email or password")
+		requestLogger(req).Info("Incorrect email or password")
+		failure.After = map[string]any{"reason": "unknown_email"}
+		cfg.recordAudit(req.Context(), failure)
+		cfg.metrics.logins.WithLabelValues("failure").Inc()
 		w.WriteHeader(401)
 		return
 	}
 	err = auth.CheckPasswordHash(dbUser.HashedPassword, params.Password)
 	if err != nil {
-		log.Print("Incorrect email or password")
+		requestLogger(req).Info("Incorrect email or password")
+		failure.After = map[string]any{"reason": "wrong_password"}
+		cfg.recordAudit(req.Context(), failure)
+		cfg.metrics.logins.WithLabelValues("failure").Inc()
 		w.WriteHeader(401)
 		return
 	}
+	suspended, err := cfg.queries.IsSuspended(context.Background(), dbUser.ID)
+	if err != nil {
+		requestLogger(req).Error("Error checking suspension", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	if suspended {
+		failure.After = map[string]any{"reason": "suspended"}
+		cfg.recordAudit(req.Context(), failure)
+		cfg.metrics.logins.WithLabelValues("failure").Inc()
+		respondWithError(w, 403, errSuspended.Error())
+		return
+	}
 	// Create JWT token.
 	token := ""
-	token, err = auth.MakeJWT(dbUser.ID, cfg.secret, time.Hour)
+	token, err = auth.MakeJWT(dbUser.ID, cfg.secret, cfg.accessTokenTTL)
 	if err != nil {
-		log.Printf("Error creating JWT: %s", err)
+		requestLogger(req).Error("Error creating JWT", "error", err)
 		w.WriteHeader(500)
 	}
 	// Create refresh token.
 	refreshToken, err := auth.MakeRefreshToken()
 	if err != nil {
-		log.Printf("Error creating refresh token: %s", err)
+		requestLogger(req).Error("Error creating refresh token", "error", err)
 		w.WriteHeader(500)
 	}
 	// Store refresh token in database.
-	refTokenParams := database.CreateRefreshTokenParams{Token: refreshToken, ExpiresAt: sql.NullTime{Time: time.Now().Add(time.Hour * 24 * 60), Valid: true}, UserID: dbUser.ID, RevokedAt: sql.NullTime{Valid: false}}
+	refTokenParams := database.CreateRefreshTokenParams{Token: refreshToken, ExpiresAt: sql.NullTime{Time: time.Now().Add(cfg.refreshTokenTTL), Valid: true}, UserID: dbUser.ID, RevokedAt: sql.NullTime{Valid: false}}
 	dbRefToken, err := cfg.queries.CreateRefreshToken(context.Background(), refTokenParams)
 	if err != nil {
-		log.Printf("Error storing refresh token: %s", err)
+		requestLogger(req).Error("Error storing refresh token", "error", err)
+		w.WriteHeader(500)
+	}
+	cfg.metrics.logins.WithLabelValues("success").Inc()
+	event := requestAuditEvent(req, audit.ActionLogin)
+	event.ActorID = userActor(dbUser.ID)
+	event.TargetType, event.TargetID = "user", dbUser.ID.String()
+	cfg.recordAudit(req.Context(), event)
+
+	ents, err := cfg.entitlements(dbUser.ID)
+	if err != nil {
+		requestLogger(req).Error("Error getting entitlements", "error", err)
 		w.WriteHeader(500)
+		return
 	}
 
-	user := User{ID: dbUser.ID, CreatedAt: dbUser.CreatedAt, UpdatedAt: dbUser.UpdatedAt, Email: dbUser.Email, Token: token, RefreshToken: dbRefToken.Token, IsChirpyRed: dbUser.IsChirpyRed.Bool}
+	user := User{ID: dbUser.ID, CreatedAt: dbUser.CreatedAt, UpdatedAt: dbUser.UpdatedAt, Email: dbUser.Email, Handle: dbUser.Handle.String, DisplayName: dbUser.DisplayName, Token: token, RefreshToken: dbRefToken.Token, IsChirpyRed: ents.Plan == entitlements.PlanChirpyRed, Entitlements: &ents}
 	respondWithJSON(w, 200, user)
 }
 
@@ -343,7 +848,7 @@ func (cfg *apiConfig) refreshHandler(w http.ResponseWriter, req *http.Request) {
 	// Get refresh token from header.
 	refToken, err := auth.GetBearerToken(req.Header)
 	if err != nil {
-		log.Printf("Error getting refresh token: %s", err)
+		requestLogger(req).Warn("Error getting refresh token", "error", err)
 		w.WriteHeader(401)
 		return
 	}
@@ -351,7 +856,7 @@ func (cfg *apiConfig) refreshHandler(w http.ResponseWriter, req *http.Request) {
 	// Get associated user from database.
 	dbRefToken, err := cfg.queries.GetUserByToken(context.Background(), refToken)
 	if err != nil {
-		log.Printf("Invalid refresh token: %s", err)
+		requestLogger(req).Warn("Invalid refresh token", "error", err)
 		w.WriteHeader(401)
 		return
 	}
@@ -362,12 +867,16 @@ func (cfg *apiConfig) refreshHandler(w http.ResponseWriter, req *http.Request) {
 	}
 	// Create new JWT that expires in 1 hour.
 	token := ""
-	token, err = auth.MakeJWT(dbRefToken.UserID, cfg.secret, time.Hour)
+	token, err = auth.MakeJWT(dbRefToken.UserID, cfg.secret, cfg.accessTokenTTL)
 	if err != nil {
-		log.Printf("Error creating JWT: %s", err)
+		requestLogger(req).Error("Error creating JWT", "error", err)
 		w.WriteHeader(500)
 		return
 	}
+	event := requestAuditEvent(req, audit.ActionTokenRefresh)
+	event.ActorID = userActor(dbRefToken.UserID)
+	event.TargetType, event.TargetID = "user", dbRefToken.UserID.String()
+	cfg.recordAudit(req.Context(), event)
 
 	respBody := TokenString{Token: token}
 	respondWithJSON(w, 200, respBody)
@@ -377,16 +886,24 @@ func (cfg *apiConfig) revokeHandler(w http.ResponseWriter, req *http.Request) {
 	// Get refresh token from header.
 	refToken, err := auth.GetBearerToken(req.Header)
 	if err != nil {
-		log.Printf("Error getting refresh token: %s", err)
+		requestLogger(req).Warn("Error getting refresh token", "error", err)
 		w.WriteHeader(401)
 		return
 	}
 	err = cfg.queries.RevokeToken(context.Background(), refToken)
 	if err != nil {
-		log.Printf("Error revoking refresh token: %s", err)
+		requestLogger(req).Warn("Error revoking refresh token", "error", err)
 		w.WriteHeader(401)
 		return
 	}
+	event := requestAuditEvent(req, audit.ActionTokenRevoke)
+	// Unknown tokens are still accepted, but only known ones have an owner.
+	dbRefToken, err := cfg.queries.GetUserByToken(context.Background(), refToken)
+	if err == nil {
+		event.ActorID = userActor(dbRefToken.UserID)
+		event.TargetType, event.TargetID = "user", dbRefToken.UserID.String()
+	}
+	cfg.recordAudit(req.Context(), event)
 	w.WriteHeader(204)
 	return
 }
@@ -395,63 +912,121 @@ func (cfg *apiConfig) updateUserHandler(w http.ResponseWriter, req *http.Request
 	// Get refresh token from header.
 	token, err := auth.GetBearerToken(req.Header)
 	if err != nil {
-		log.Printf("Error getting access token: %s", err)
+		requestLogger(req).Warn("Error getting access token", "error", err)
 		w.WriteHeader(401)
 		return
 	}
 
 	// Use refresh token to get user by ID.
-	userID, err := auth.ValidateJWT(token, cfg.secret)
+	userID, err := cfg.validateToken(token)
 	if err != nil {
-		log.Print("Invalid token.")
-		w.WriteHeader(401)
+		respondAuthError(w, req, err)
 		return
 	}
 	dbUser, err := cfg.queries.GetUserByID(context.Background(), userID)
 	if err != nil {
-		log.Printf("Error getting user by ID: %s", err)
+		requestLogger(req).Warn("Error getting user by ID", "error", err)
 		w.WriteHeader(401)
 		return
 	}
 
-	// Get new email and password from request body.
+	// Only the fields that were sent are changed.
 	type parameters struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Email       *string `json:"email"`
+		Password    *string `json:"password"`
+		Handle      *string `json:"handle"`
+		DisplayName *string `json:"display_name"`
 	}
 	decoder := json.NewDecoder(req.Body)
 	params := parameters{}
 	err = decoder.Decode(&params)
 	if err != nil {
-		log.Printf("Error decoding parameters: %s", err)
+		requestLogger(req).Error("Error decoding parameters", "error", err)
 		w.WriteHeader(500)
 		return
 	}
+	if params.Email != nil && *params.Email == "" {
+		respondWithError(w, 400, "Email can't be empty")
+		return
+	}
+	if params.Password != nil && *params.Password == "" {
+		respondWithError(w, 400, "Password can't be empty")
+		return
+	}
+	if params.Handle != nil && *params.Handle != "" && !validHandle.MatchString(*params.Handle) {
+		respondWithError(w, 400, "Handle must be 1-30 letters, digits or underscores")
+		return
+	}
+
+	updateParams := database.UpdateEmailPassParams{ID: dbUser.ID, Email: dbUser.Email, HashedPassword: dbUser.HashedPassword}
+	if params.Email != nil {
+		updateParams.Email = *params.Email
+	}
+	passwordChanged := params.Password != nil && auth.CheckPasswordHash(dbUser.HashedPassword, *params.Password) != nil
+	if passwordChanged {
+		updateParams.HashedPassword, err = auth.HashPassword(*params.Password)
+		if err != nil {
+			requestLogger(req).Error("Error hashing password", "error", err)
+			w.WriteHeader(500)
+			return
+		}
+	}
+	profileParams := database.UpdateProfileParams{ID: dbUser.ID, Handle: dbUser.Handle, DisplayName: dbUser.DisplayName}
+	if params.Handle != nil {
+		profileParams.Handle = sql.NullString{String: *params.Handle, Valid: *params.Handle != ""}
+	}
+	if params.DisplayName != nil {
+		profileParams.DisplayName = *params.DisplayName
+	}
 
-	// Hash new password.
-	hashedPass, err := auth.HashPassword(params.Password)
+	// Both updates commit together, so a taken handle doesn't leave a
+	// half-applied change.
+	tx, err := cfg.db.Begin()
 	if err != nil {
-		log.Printf("Error hashing password: %s", err)
+		requestLogger(req).Error("Error starting transaction", "error", err)
 		w.WriteHeader(500)
 		return
 	}
-
-	updateParams := database.UpdateEmailPassParams{ID: dbUser.ID, Email: params.Email, HashedPassword: hashedPass}
-	err = cfg.queries.UpdateEmailPass(context.Background(), updateParams)
+	defer tx.Rollback()
+	qtx := cfg.queries.WithTx(tx)
+	err = qtx.UpdateEmailPass(context.Background(), updateParams)
+	if err == nil {
+		err = qtx.UpdateProfile(context.Background(), profileParams)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if isUniqueViolation(err) {
+		respondWithError(w, 409, "Email or handle is already taken")
+		return
+	}
 	if err != nil {
-		log.Print("Error updating email & password.")
+		requestLogger(req).Error("Error updating user", "error", err)
 		w.WriteHeader(500)
 		return
 	}
 
 	// Get User from database, with changes.
+	before := dbUser
 	dbUser, err = cfg.queries.GetUserByID(context.Background(), dbUser.ID)
 	if err != nil {
-		log.Print("Wrong userID.")
+		requestLogger(req).Info("Wrong userID")
 		w.WriteHeader(401)
 		return
 	}
-	user := User{ID: dbUser.ID, CreatedAt: dbUser.CreatedAt, UpdatedAt: dbUser.UpdatedAt, Email: dbUser.Email, IsChirpyRed: dbUser.IsChirpyRed.Bool}
+	event := requestAuditEvent(req, audit.ActionUserUpdate)
+	event.ActorID = userActor(dbUser.ID)
+	event.TargetType, event.TargetID = "user", dbUser.ID.String()
+	event.Before = map[string]any{"email": before.Email, "handle": before.Handle.String, "display_name": before.DisplayName, "password_changed": false}
+	event.After = map[string]any{"email": dbUser.Email, "handle": dbUser.Handle.String, "display_name": dbUser.DisplayName, "password_changed": passwordChanged}
+	cfg.recordAudit(req.Context(), event)
+	ents, err := cfg.entitlements(dbUser.ID)
+	if err != nil {
+		requestLogger(req).Error("Error getting entitlements", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	user := User{ID: dbUser.ID, CreatedAt: dbUser.CreatedAt, UpdatedAt: dbUser.UpdatedAt, Email: dbUser.Email, Handle: dbUser.Handle.String, DisplayName: dbUser.DisplayName, IsChirpyRed: ents.Plan == entitlements.PlanChirpyRed}
 	respondWithJSON(w, 200, user)
 }
 
@@ -459,94 +1034,55 @@ func (cfg *apiConfig) delChirpHandler(w http.ResponseWriter, req *http.Request)
 	// Get refresh token from header.
 	token, err := auth.GetBearerToken(req.Header)
 	if err != nil {
-		log.Printf("Error getting access token: %s", err)
+		requestLogger(req).Warn("Error getting access token", "error", err)
 		w.WriteHeader(401)
 		return
 	}
 
 	// Use refresh token to get user by ID.
-	userID, err := auth.ValidateJWT(token, cfg.secret)
+	userID, err := cfg.validateToken(token)
 	if err != nil {
-		log.Print("Invalid token.")
-		w.WriteHeader(401)
+		respondAuthError(w, req, err)
 		return
 	}
 
 	// Get Chirp ID from request path.
 	chirpID, err := uuid.Parse(req.PathValue("chirpID"))
 	if err != nil {
-		log.Printf("Error parsing uuid: %s", err)
+		requestLogger(req).Warn("Error parsing uuid", "error", err)
 		w.WriteHeader(400)
 		return
 	}
 	// Get Chirp from database.
 	dbChirp, err := cfg.queries.GetChirp(context.Background(), chirpID)
 	if err != nil {
-		log.Print("Chirp not found.")
+		requestLogger(req).Info("Chirp not found")
 		w.WriteHeader(404)
 		return
 	}
 
 	// Ensure UserID == dbCHirp.UserID.
 	if userID != dbChirp.UserID {
-		log.Print("Invalid User.")
+		requestLogger(req).Info("Invalid User")
 		w.WriteHeader(403)
 		return
 	}
-	err = cfg.queries.DeleteChirp(context.Background(), chirpID)
+	// Deleted chirps go to the author's trash until they're purged.
+	deleted, err := cfg.queries.SoftDeleteChirp(context.Background(), chirpID)
 	if err != nil {
-		log.Print("Chirp not found.")
-		w.WriteHeader(404)
-		return
-	}
-	w.WriteHeader(204)
-}
-
-func (cfg *apiConfig) polkaWebHookHandler(w http.ResponseWriter, req *http.Request) {
-	type paramdata struct {
-		UserID string `json:"user_id"`
-	}
-	type parameters struct {
-		Event string    `json:"event"`
-		Data  paramdata `json:"data"`
-	}
-	// Authorize upgrading account with API key.
-	reqAPIKey, err := auth.GetAPIKey(req.Header)
-	if err != nil {
-		log.Printf("Error getting API Key: %s", err)
-		w.WriteHeader(401)
-		return
-	}
-	if reqAPIKey != cfg.polkaKey {
-		log.Print("Incorrect API Key")
-		w.WriteHeader(401)
-		return
-	}
-
-	decoder := json.NewDecoder(req.Body)
-	params := parameters{}
-	err = decoder.Decode(&params)
-	if err != nil {
-		log.Printf("Error decoding parameters: %s", err)
+		requestLogger(req).Error("Error deleting chirp", "error", err)
 		w.WriteHeader(500)
 		return
 	}
-
-	if params.Event != "user.upgraded" {
-		w.WriteHeader(204)
-		return
-	}
-	userID, err := uuid.Parse(params.Data.UserID)
-	if err != nil {
-		log.Printf("Error getting UUID: %s", err)
-		w.WriteHeader(500)
+	if deleted == 0 {
+		requestLogger(req).Info("Chirp not found")
+		w.WriteHeader(404)
 		return
 	}
-	err = cfg.queries.UpgradeUser(context.Background(), userID)
+	err = cfg.broker.Publish(context.Background(), pubsub.ChirpDeleted, dbChirp.UserID, map[string]uuid.UUID{"id": chirpID})
 	if err != nil {
-		log.Printf("Error upgrading user: %s", err)
-		w.WriteHeader(404)
-		return
+		requestLogger(req).Error("Error publishing chirp deletion", "error", err)
 	}
+	cfg.queueWebhookEvent(req.Context(), dbChirp.UserID, eventChirpDeleted, map[string]uuid.UUID{"id": chirpID})
 	w.WriteHeader(204)
 }
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/curtisbraxdale/chirpy/internal/config"
+	"github.com/curtisbraxdale/chirpy/internal/database"
+	"github.com/curtisbraxdale/chirpy/internal/media"
+	"github.com/curtisbraxdale/chirpy/internal/storage"
+	"github.com/google/uuid"
+)
+
+var errInvalidMedia = errors.New("Invalid media")
+
+type Media struct {
+	ID           uuid.UUID `json:"id"`
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnail_url"`
+	ContentType  string    `json:"content_type"`
+	Width        int32     `json:"width"`
+	Height       int32     `json:"height"`
+}
+
+func (cfg *apiConfig) newMedia(m database.Medium) Media {
+	return Media{
+		ID:           m.ID,
+		URL:          cfg.store.URL(m.StorageKey),
+		ThumbnailURL: cfg.store.URL(m.ThumbnailKey),
+		ContentType:  m.ContentType,
+		Width:        m.Width,
+		Height:       m.Height,
+	}
+}
+
+// newStore picks the blob store from the config. Local storage is served by
+// this server under /media/.
+func newStore(m config.Media) storage.Store {
+	if m.Backend == config.MediaS3 {
+		return storage.S3{
+			Endpoint:  m.S3Endpoint,
+			Region:    m.S3Region,
+			Bucket:    m.S3Bucket,
+			AccessKey: m.S3AccessKey,
+			SecretKey: m.S3SecretKey,
+			PublicURL: m.S3PublicURL,
+		}
+	}
+	return storage.Local{Dir: m.Dir, BaseURL: m.BaseURL}
+}
+
+func (cfg *apiConfig) uploadMediaHandler(w http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		respondAuthError(w, req, err)
+		return
+	}
+	// Leave room for the multipart framing around the file.
+	req.Body = http.MaxBytesReader(w, req.Body, media.MaxUploadSize+64<<10)
+	file, _, err := req.FormFile("file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			respondWithError(w, 413, "File is too large")
+			return
+		}
+		respondWithError(w, 400, "Missing file")
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, media.MaxUploadSize+1))
+	if err != nil {
+		requestLogger(req).Error("Error reading upload", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	if len(data) > media.MaxUploadSize {
+		respondWithError(w, 413, "File is too large")
+		return
+	}
+
+	img, err := media.Process(data)
+	if errors.Is(err, media.ErrUnsupportedType) {
+		respondWithError(w, 415, err.Error())
+		return
+	}
+	if err != nil {
+		respondWithError(w, 400, "Invalid image")
+		return
+	}
+
+	id := uuid.New()
+	key := "media/" + id.String() + "." + img.Extension
+	thumbnailKey := "media/" + id.String() + "_thumb." + thumbnailExtension(img.ThumbnailType)
+	err = cfg.store.Put(req.Context(), key, img.ContentType, img.Data)
+	if err != nil {
+		requestLogger(req).Error("Error storing media", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	err = cfg.store.Put(req.Context(), thumbnailKey, img.ThumbnailType, img.Thumbnail)
+	if err != nil {
+		requestLogger(req).Error("Error storing thumbnail", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	mediaParams := database.CreateMediaParams{
+		ID:           id,
+		UserID:       userID,
+		ContentType:  img.ContentType,
+		StorageKey:   key,
+		ThumbnailKey: thumbnailKey,
+		Width:        int32(img.Width),
+		Height:       int32(img.Height),
+		SizeBytes:    int64(len(img.Data)),
+	}
+	dbMedia, err := cfg.queries.CreateMedia(context.Background(), mediaParams)
+	if err != nil {
+		requestLogger(req).Error("Error creating media", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	respondWithJSON(w, 201, cfg.newMedia(dbMedia))
+}
+
+func thumbnailExtension(contentType string) string {
+	if contentType == "image/jpeg" {
+		return "jpg"
+	}
+	return "png"
+}
+
+// attachMedia links the author's unattached uploads to a new chirp, in the
+// order given. It returns errInvalidMedia if any ID isn't one of them.
+func attachMedia(q *database.Queries, chirpID, userID uuid.UUID, mediaIDs []uuid.UUID) error {
+	for i, mediaID := range mediaIDs {
+		attached, err := q.AttachMedia(context.Background(), database.AttachMediaParams{
+			ChirpID:  uuid.NullUUID{UUID: chirpID, Valid: true},
+			Position: sql.NullInt32{Int32: int32(i), Valid: true},
+			ID:       mediaID,
+			UserID:   userID,
+		})
+		if err != nil {
+			return err
+		}
+		if attached == 0 {
+			return errInvalidMedia
+		}
+	}
+	return nil
+}
+
+// loadChirpMedia fills in the media on a page of chirps with one query.
+func (cfg *apiConfig) loadChirpMedia(chirps []Chirp) error {
+	if len(chirps) == 0 {
+		return nil
+	}
+	ids := make([]uuid.UUID, len(chirps))
+	for i, c := range chirps {
+		ids[i] = c.ID
+	}
+	dbMedia, err := cfg.queries.ListMediaForChirps(context.Background(), ids)
+	if err != nil {
+		return err
+	}
+	byChirp := map[uuid.UUID][]Media{}
+	for _, m := range dbMedia {
+		byChirp[m.ChirpID.UUID] = append(byChirp[m.ChirpID.UUID], cfg.newMedia(m))
+	}
+	for i := range chirps {
+		chirps[i].Media = byChirp[chirps[i].ID]
+		if chirps[i].Media == nil {
+			chirps[i].Media = []Media{}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/curtisbraxdale/chirpy/internal/database"
+	"github.com/curtisbraxdale/chirpy/internal/pubsub"
+	"github.com/google/uuid"
+)
+
+const (
+	// maxConversationSize includes the user starting the conversation.
+	maxConversationSize = 10
+	maxMessageLength    = 1000
+)
+
+type Conversation struct {
+	ID             uuid.UUID      `json:"id"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	ParticipantIDs []uuid.UUID    `json:"participant_ids"`
+	LastMessage    *DirectMessage `json:"last_message"`
+	UnreadCount    int64          `json:"unread_count"`
+}
+
+type DirectMessage struct {
+	ID             uuid.UUID `json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	ConversationID uuid.UUID `json:"conversation_id"`
+	SenderID       uuid.UUID `json:"sender_id"`
+	Body           string    `json:"body"`
+}
+
+func newDirectMessage(m database.Message) DirectMessage {
+	return DirectMessage{ID: m.ID, CreatedAt: m.CreatedAt, ConversationID: m.ConversationID, SenderID: m.SenderID, Body: m.Body}
+}
+
+func validMessageBody(body string) bool {
+	return strings.TrimSpace(body) != "" && utf8.RuneCountInString(body) <= maxMessageLength
+}
+
+// blockedInConversation reports whether userID and any other participant have
+// blocked each other.
+func (cfg *apiConfig) blockedInConversation(userID uuid.UUID, participants []uuid.UUID) (bool, error) {
+	for _, participant := range participants {
+		if participant == userID {
+			continue
+		}
+		blocked, err := cfg.queries.HasBlock(context.Background(), database.HasBlockParams{BlockerID: userID, BlockedID: participant})
+		if err != nil || blocked {
+			return blocked, err
+		}
+	}
+	return false, nil
+}
+
+// sendMessage stores a message and pushes it to the other participants'
+// streams.
+func (cfg *apiConfig) sendMessage(conversationID, senderID uuid.UUID, participants []uuid.UUID, body string) (database.Message, error) {
+	dbMessage, err := cfg.queries.CreateMessage(context.Background(), database.CreateMessageParams{ConversationID: conversationID, SenderID: senderID, Body: body})
+	if err != nil {
+		return database.Message{}, err
+	}
+	err = cfg.queries.TouchConversation(context.Background(), conversationID)
+	if err != nil {
+		return database.Message{}, err
+	}
+	message := newDirectMessage(dbMessage)
+	for _, participant := range participants {
+		if participant == senderID {
+			continue
+		}
+		err = cfg.broker.Publish(context.Background(), pubsub.MessageCreated, participant, message)
+		if err != nil {
+			slog.Error("Error publishing message", "error", err)
+		}
+	}
+	return dbMessage, nil
+}
+
+// conversationParticipants loads the participants of the conversation in the
+// request path, writing a 404 unless userID is one of them.
+func (cfg *apiConfig) conversationParticipants(w http.ResponseWriter, req *http.Request, userID uuid.UUID) (uuid.UUID, []uuid.UUID, bool) {
+	conversationID, err := uuid.Parse(req.PathValue("conversationID"))
+	if err != nil {
+		requestLogger(req).Warn("Error parsing uuid", "error", err)
+		w.WriteHeader(400)
+		return uuid.Nil, nil, false
+	}
+	participants, err := cfg.queries.GetConversationParticipantIDs(context.Background(), conversationID)
+	if err != nil {
+		requestLogger(req).Error("Error getting participants", "error", err)
+		w.WriteHeader(500)
+		return uuid.Nil, nil, false
+	}
+	if !slices.Contains(participants, userID) {
+		w.WriteHeader(404)
+		return uuid.Nil, nil, false
+	}
+	return conversationID, participants, true
+}
+
+func (cfg *apiConfig) createConversationHandler(w http.ResponseWriter, req *http.Request) {
+	type parameters struct {
+		ParticipantIDs []uuid.UUID `json:"participant_ids"`
+		Body           string      `json:"body"`
+	}
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		respondAuthError(w, req, err)
+		return
+	}
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		requestLogger(req).Error("Error decoding parameters", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	participants := []uuid.UUID{userID}
+	for _, id := range params.ParticipantIDs {
+		if !slices.Contains(participants, id) {
+			participants = append(participants, id)
+		}
+	}
+	if len(participants) < 2 || len(participants) > maxConversationSize {
+		respondWithError(w, 400, "Conversations need between 1 and 9 other participants")
+		return
+	}
+	if params.Body != "" && !validMessageBody(params.Body) {
+		respondWithError(w, 400, "Message must be 1-1000 characters")
+		return
+	}
+	blocked, err := cfg.blockedInConversation(userID, participants)
+	if err != nil {
+		requestLogger(req).Error("Error checking blocks", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	if blocked {
+		respondWithError(w, 403, "Can't message this user")
+		return
+	}
+
+	dbConversation, created, err := cfg.findOrCreateConversation(participants)
+	if isForeignKeyViolation(err) {
+		respondWithError(w, 404, "User not found")
+		return
+	}
+	if err != nil {
+		requestLogger(req).Error("Error creating conversation", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	status := 200
+	if created {
+		status = 201
+	}
+
+	conversation := Conversation{ID: dbConversation.ID, CreatedAt: dbConversation.CreatedAt, UpdatedAt: dbConversation.UpdatedAt, ParticipantIDs: participants}
+	if params.Body != "" {
+		dbMessage, err := cfg.sendMessage(dbConversation.ID, userID, participants, params.Body)
+		if err != nil {
+			requestLogger(req).Error("Error sending message", "error", err)
+			w.WriteHeader(500)
+			return
+		}
+		message := newDirectMessage(dbMessage)
+		conversation.LastMessage = &message
+		conversation.UpdatedAt = dbMessage.CreatedAt
+	}
+	respondWithJSON(w, status, conversation)
+}
+
+// findOrCreateConversation starts a conversation between participants and
+// reports whether it is new. A one-to-one conversation is reused rather than
+// started again; the pair is locked while looking, so two requests at once
+// end up in the same conversation.
+func (cfg *apiConfig) findOrCreateConversation(participants []uuid.UUID) (database.Conversation, bool, error) {
+	tx, err := cfg.db.Begin()
+	if err != nil {
+		return database.Conversation{}, false, err
+	}
+	defer tx.Rollback()
+	qtx := cfg.queries.WithTx(tx)
+	if len(participants) == 2 {
+		err = qtx.LockDirectConversation(context.Background(), database.LockDirectConversationParams{FirstUserID: participants[0], SecondUserID: participants[1]})
+		if err != nil {
+			return database.Conversation{}, false, err
+		}
+		dbConversation, err := qtx.FindDirectConversation(context.Background(), database.FindDirectConversationParams{FirstUserID: participants[0], SecondUserID: participants[1]})
+		if err == nil {
+			return dbConversation, false, tx.Commit()
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return database.Conversation{}, false, err
+		}
+	}
+	dbConversation, err := qtx.CreateConversation(context.Background())
+	if err != nil {
+		return database.Conversation{}, false, err
+	}
+	for _, participant := range participants {
+		err = qtx.AddConversationParticipant(context.Background(), database.AddConversationParticipantParams{ConversationID: dbConversation.ID, UserID: participant})
+		if err != nil {
+			return database.Conversation{}, false, err
+		}
+	}
+	return dbConversation, true, tx.Commit()
+}
+
+func (cfg *apiConfig) listConversationsHandler(w http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		respondAuthError(w, req, err)
+		return
+	}
+	limit, offset, err := parsePagination(req)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	dbConversations, err := cfg.queries.ListConversations(context.Background(), database.ListConversationsParams{UserID: userID, RowLimit: limit, RowOffset: offset})
+	if err != nil {
+		requestLogger(req).Error("Error listing conversations", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	conversations := []Conversation{}
+	for _, c := range dbConversations {
+		conversation := Conversation{ID: c.ID, CreatedAt: c.CreatedAt, UpdatedAt: c.UpdatedAt, ParticipantIDs: c.ParticipantIds, UnreadCount: c.UnreadCount}
+		if c.LastMessageID.Valid {
+			conversation.LastMessage = &DirectMessage{ID: c.LastMessageID.UUID, CreatedAt: c.LastMessageCreatedAt.Time, ConversationID: c.ID, SenderID: c.LastMessageSenderID.UUID, Body: c.LastMessageBody.String}
+		}
+		conversations = append(conversations, conversation)
+	}
+	respondWithJSON(w, 200, conversations)
+}
+
+func (cfg *apiConfig) listMessagesHandler(w http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		respondAuthError(w, req, err)
+		return
+	}
+	conversationID, _, ok := cfg.conversationParticipants(w, req, userID)
+	if !ok {
+		return
+	}
+	limit, offset, err := parsePagination(req)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	dbMessages, err := cfg.queries.ListMessages(context.Background(), database.ListMessagesParams{ConversationID: conversationID, Limit: limit, Offset: offset})
+	if err != nil {
+		requestLogger(req).Error("Error listing messages", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	// Newest first, so offset pages back through the history.
+	messages := []DirectMessage{}
+	for _, m := range dbMessages {
+		messages = append(messages, newDirectMessage(m))
+	}
+	respondWithJSON(w, 200, messages)
+}
+
+func (cfg *apiConfig) createMessageHandler(w http.ResponseWriter, req *http.Request) {
+	type parameters struct {
+		Body string `json:"body"`
+	}
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		respondAuthError(w, req, err)
+		return
+	}
+	conversationID, participants, ok := cfg.conversationParticipants(w, req, userID)
+	if !ok {
+		return
+	}
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		requestLogger(req).Error("Error decoding parameters", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	if !validMessageBody(params.Body) {
+		respondWithError(w, 400, "Message must be 1-1000 characters")
+		return
+	}
+	blocked, err := cfg.blockedInConversation(userID, participants)
+	if err != nil {
+		requestLogger(req).Error("Error checking blocks", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	if blocked {
+		respondWithError(w, 403, "Can't message this user")
+		return
+	}
+
+	dbMessage, err := cfg.sendMessage(conversationID, userID, participants, params.Body)
+	if err != nil {
+		requestLogger(req).Error("Error sending message", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	respondWithJSON(w, 201, newDirectMessage(dbMessage))
+}
+
+func (cfg *apiConfig) readConversationHandler(w http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		respondAuthError(w, req, err)
+		return
+	}
+	conversationID, err := uuid.Parse(req.PathValue("conversationID"))
+	if err != nil {
+		requestLogger(req).Warn("Error parsing uuid", "error", err)
+		w.WriteHeader(400)
+		return
+	}
+	updated, err := cfg.queries.MarkConversationRead(context.Background(), database.MarkConversationReadParams{ConversationID: conversationID, UserID: userID})
+	if err != nil {
+		requestLogger(req).Error("Error marking conversation read", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	if updated == 0 {
+		w.WriteHeader(404)
+		return
+	}
+	w.WriteHeader(204)
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/curtisbraxdale/chirpy/internal/auth"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metrics holds Chirpy's Prometheus collectors. They are all in one
+// registry, served at /metrics and read by the admin page.
+type metrics struct {
+	registry *prometheus.Registry
+
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	fileserverHits  prometheus.Counter
+	// hitsBaseline is the hit count at the last admin reset. Counters can't
+	// go down, so the admin page shows hits since then.
+	hitsBaseline atomic.Uint64
+
+	logins           *prometheus.CounterVec
+	chirpsCreated    prometheus.Counter
+	webhooksReceived *prometheus.CounterVec
+	webhookEvents    *prometheus.CounterVec
+	webhookDelivery  *prometheus.CounterVec
+}
+
+func newMetrics(db *sql.DB) *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "chirpy_http_requests_total",
+			Help: "HTTP requests by route, method and status.",
+		}, []string{"route", "method", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "chirpy_http_request_duration_seconds",
+			Help:    "HTTP request latency by route, method and status.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		fileserverHits: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "chirpy_fileserver_hits_total",
+			Help: "Requests for the web app's files.",
+		}),
+		logins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "chirpy_logins_total",
+			Help: "Login attempts by result.",
+		}, []string{"result"}),
+		chirpsCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "chirpy_chirps_created_total",
+			Help: "Chirps published, including scheduled ones.",
+		}),
+		webhooksReceived: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "chirpy_webhooks_received_total",
+			Help: "Incoming webhooks by source and outcome.",
+		}, []string{"source", "outcome"}),
+		webhookEvents: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "chirpy_webhook_events_processed_total",
+			Help: "Incoming webhook events worked by the inbox, by source and outcome.",
+		}, []string{"source", "outcome"}),
+		webhookDelivery: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "chirpy_webhook_delivery_attempts_total",
+			Help: "Outbound webhook delivery attempts by outcome.",
+		}, []string{"outcome"}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		collectors.NewDBStatsCollector(db, "chirpy"),
+		m.requests,
+		m.requestDuration,
+		m.fileserverHits,
+		m.logins,
+		m.chirpsCreated,
+		m.webhooksReceived,
+		m.webhookEvents,
+		m.webhookDelivery,
+	)
+	return m
+}
+
+// metricsHandler serves the registry to scrapers that send METRICS_TOKEN as
+// a bearer token. The metrics include route and database pool details that
+// shouldn't be public, so without a token the endpoint is off.
+func (cfg *apiConfig) metricsHandler() http.Handler {
+	promHandler := promhttp.HandlerFor(cfg.metrics.registry, promhttp.HandlerOpts{})
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if cfg.metricsToken == "" {
+			w.WriteHeader(404)
+			return
+		}
+		token, err := auth.GetBearerToken(req.Header)
+		if err != nil || subtle.ConstantTimeCompare([]byte(token), []byte(cfg.metricsToken)) != 1 {
+			requestLogger(req).Warn("Invalid metrics token")
+			w.WriteHeader(401)
+			return
+		}
+		promHandler.ServeHTTP(w, req)
+	})
+}
+
+// hits returns the file server hits since the last reset, read back from
+// the registry.
+func (m *metrics) hits() uint64 {
+	families, err := m.registry.Gather()
+	if err != nil {
+		return 0
+	}
+	for _, f := range families {
+		if f.GetName() == "chirpy_fileserver_hits_total" && len(f.GetMetric()) == 1 {
+			return uint64(f.GetMetric()[0].GetCounter().GetValue()) - m.hitsBaseline.Load()
+		}
+	}
+	return 0
+}
+
+func (m *metrics) resetHits() {
+	m.hitsBaseline.Add(m.hits())
+}
+
+// metricMethods are the methods that get their own label value. Anything
+// else a client sends is counted as "other", so it can't add series.
+var metricMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions}
+
+// middlewareMetrics counts requests and their latency. The route label is
+// the ServeMux pattern that matched, so IDs in paths don't each get a
+// series.
+func (cfg *apiConfig) middlewareMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, req)
+
+		// ServeMux sets the pattern on the request it was given. The method
+		// part is dropped since it has its own label.
+		route := req.Pattern
+		if _, path, ok := strings.Cut(route, " "); ok {
+			route = path
+		}
+		if route == "" {
+			route = "unmatched"
+		}
+		status := rec.status
+		if status == 0 {
+			status = 200
+		}
+		method := req.Method
+		if !slices.Contains(metricMethods, method) {
+			method = "other"
+		}
+		labels := prometheus.Labels{"route": route, "method": method, "status": strconv.Itoa(status)}
+		cfg.metrics.requests.With(labels).Inc()
+		cfg.metrics.requestDuration.With(labels).Observe(time.Since(start).Seconds())
+	})
+}
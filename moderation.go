@@ -0,0 +1,448 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/curtisbraxdale/chirpy/internal/audit"
+	"github.com/curtisbraxdale/chirpy/internal/database"
+	"github.com/curtisbraxdale/chirpy/internal/notify"
+	"github.com/curtisbraxdale/chirpy/internal/pubsub"
+	"github.com/google/uuid"
+)
+
+const (
+	roleModerator = "moderator"
+
+	maxReportDetailsLength = 1000
+)
+
+const (
+	reportOpen      = "open"
+	reportDismissed = "dismissed"
+	reportActioned  = "actioned"
+)
+
+const (
+	actionDismiss     = "dismiss"
+	actionHideChirp   = "hide_chirp"
+	actionDeleteChirp = "delete_chirp"
+	actionWarn        = "warn"
+	actionSuspend     = "suspend"
+	actionBan         = "ban"
+	actionUnsuspend   = "unsuspend"
+)
+
+// maxSuspensionHours is ten years. Anything longer should be a ban.
+const maxSuspensionHours = 10 * 365 * 24
+
+var reportReasons = []string{"spam", "harassment", "hate", "violence", "sexual", "self_harm", "misinformation", "impersonation", "other"}
+
+var (
+	errSuspended      = errors.New("Account suspended")
+	errReportResolved = errors.New("Report already resolved")
+	errBanned         = errors.New("User is banned; unsuspend them before setting a timed suspension")
+	errNotSuspended   = errors.New("User isn't suspended")
+)
+
+type Report struct {
+	ID           uuid.UUID  `json:"id"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ReporterID   uuid.UUID  `json:"reporter_id"`
+	TargetUserID uuid.UUID  `json:"user_id"`
+	ChirpID      *uuid.UUID `json:"chirp_id"`
+	// ChirpBody is the reported chirp as stored, even if it has been hidden.
+	ChirpBody  string     `json:"chirp_body,omitempty"`
+	Reason     string     `json:"reason"`
+	Details    string     `json:"details"`
+	Status     string     `json:"status"`
+	ResolvedAt *time.Time `json:"resolved_at"`
+	ResolvedBy *uuid.UUID `json:"resolved_by"`
+}
+
+func newReport(r database.Report) Report {
+	report := Report{ID: r.ID, CreatedAt: r.CreatedAt, ReporterID: r.ReporterID, TargetUserID: r.TargetUserID, Reason: r.Reason, Details: r.Details, Status: r.Status}
+	if r.ChirpID.Valid {
+		report.ChirpID = &r.ChirpID.UUID
+	}
+	if r.ResolvedAt.Valid {
+		report.ResolvedAt = &r.ResolvedAt.Time
+	}
+	if r.ResolvedBy.Valid {
+		report.ResolvedBy = &r.ResolvedBy.UUID
+	}
+	return report
+}
+
+type ModerationAction struct {
+	ID           uuid.UUID  `json:"id"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ModeratorID  uuid.UUID  `json:"moderator_id"`
+	Action       string     `json:"action"`
+	ReportID     *uuid.UUID `json:"report_id"`
+	TargetUserID *uuid.UUID `json:"user_id"`
+	ChirpID      *uuid.UUID `json:"chirp_id"`
+	Note         string     `json:"note"`
+	ExpiresAt    *time.Time `json:"expires_at"`
+}
+
+func newModerationAction(a database.ModerationAction) ModerationAction {
+	action := ModerationAction{ID: a.ID, CreatedAt: a.CreatedAt, ModeratorID: a.ModeratorID, Action: a.Action, Note: a.Note}
+	if a.ReportID.Valid {
+		action.ReportID = &a.ReportID.UUID
+	}
+	if a.TargetUserID.Valid {
+		action.TargetUserID = &a.TargetUserID.UUID
+	}
+	if a.ChirpID.Valid {
+		action.ChirpID = &a.ChirpID.UUID
+	}
+	if a.ExpiresAt.Valid {
+		action.ExpiresAt = &a.ExpiresAt.Time
+	}
+	return action
+}
+
+// createReportHandler reports a chirp, or an account if no chirp is given.
+func (cfg *apiConfig) createReportHandler(w http.ResponseWriter, req *http.Request) {
+	type parameters struct {
+		ChirpID *uuid.UUID `json:"chirp_id"`
+		UserID  *uuid.UUID `json:"user_id"`
+		Reason  string     `json:"reason"`
+		Details string     `json:"details"`
+	}
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		respondAuthError(w, req, err)
+		return
+	}
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		requestLogger(req).Error("Error decoding parameters", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	if !slices.Contains(reportReasons, params.Reason) {
+		respondWithError(w, 400, "Invalid reason")
+		return
+	}
+	if len(params.Details) > maxReportDetailsLength {
+		respondWithError(w, 400, "Details are too long")
+		return
+	}
+
+	reportParams := database.CreateReportParams{ReporterID: userID, Reason: params.Reason, Details: params.Details}
+	switch {
+	case params.ChirpID != nil:
+		dbChirp, err := cfg.queries.GetChirp(context.Background(), *params.ChirpID)
+		if errors.Is(err, sql.ErrNoRows) {
+			w.WriteHeader(404)
+			return
+		}
+		if err != nil {
+			requestLogger(req).Error("Error getting chirp", "error", err)
+			w.WriteHeader(500)
+			return
+		}
+		reportParams.ChirpID = uuid.NullUUID{UUID: dbChirp.ID, Valid: true}
+		reportParams.TargetUserID = dbChirp.UserID
+	case params.UserID != nil:
+		reportParams.TargetUserID = *params.UserID
+	default:
+		respondWithError(w, 400, "A chirp or user is required")
+		return
+	}
+	if reportParams.TargetUserID == userID {
+		respondWithError(w, 400, "You can't report yourself")
+		return
+	}
+
+	dbReport, err := cfg.queries.CreateReport(context.Background(), reportParams)
+	if isUniqueViolation(err) {
+		respondWithError(w, 409, "You already reported this")
+		return
+	}
+	if isForeignKeyViolation(err) {
+		w.WriteHeader(404)
+		return
+	}
+	if err != nil {
+		requestLogger(req).Error("Error creating report", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	respondWithJSON(w, 201, newReport(dbReport))
+}
+
+// listReportsHandler pages through the moderation queue, open reports by
+// default.
+func (cfg *apiConfig) listReportsHandler(w http.ResponseWriter, req *http.Request) {
+	if _, ok := cfg.requireRole(w, req, roleModerator, roleAdmin); !ok {
+		return
+	}
+	status := req.URL.Query().Get("status")
+	if status == "" {
+		status = reportOpen
+	}
+	if status != reportOpen && status != reportDismissed && status != reportActioned {
+		respondWithError(w, 400, "Invalid status")
+		return
+	}
+	limit, offset, err := parsePagination(req)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	dbReports, err := cfg.queries.ListReports(context.Background(), database.ListReportsParams{Status: status, Limit: limit, Offset: offset})
+	if err != nil {
+		requestLogger(req).Error("Error listing reports", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	reports := []Report{}
+	for _, r := range dbReports {
+		report := newReport(database.Report{ID: r.ID, CreatedAt: r.CreatedAt, ReporterID: r.ReporterID, TargetUserID: r.TargetUserID, ChirpID: r.ChirpID, Reason: r.Reason, Details: r.Details, Status: r.Status, ResolvedAt: r.ResolvedAt, ResolvedBy: r.ResolvedBy})
+		report.ChirpBody = r.Body.String
+		reports = append(reports, report)
+	}
+	respondWithJSON(w, 200, reports)
+}
+
+// moderationActionHandler applies a moderator's decision. Each action is
+// recorded in the moderation log, and resolves the report it was taken on.
+func (cfg *apiConfig) moderationActionHandler(w http.ResponseWriter, req *http.Request) {
+	type parameters struct {
+		Action   string     `json:"action"`
+		ReportID *uuid.UUID `json:"report_id"`
+		UserID   *uuid.UUID `json:"user_id"`
+		ChirpID  *uuid.UUID `json:"chirp_id"`
+		Note     string     `json:"note"`
+		// DurationHours is how long a suspension lasts.
+		DurationHours int `json:"duration_hours"`
+	}
+	moderatorID, ok := cfg.requireRole(w, req, roleModerator, roleAdmin)
+	if !ok {
+		return
+	}
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		requestLogger(req).Error("Error decoding parameters", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	actionParams := database.CreateModerationActionParams{ModeratorID: moderatorID, Action: params.Action, Note: params.Note}
+	if params.UserID != nil {
+		actionParams.TargetUserID = uuid.NullUUID{UUID: *params.UserID, Valid: true}
+	}
+	if params.ChirpID != nil {
+		actionParams.ChirpID = uuid.NullUUID{UUID: *params.ChirpID, Valid: true}
+	}
+	// Acting on a report fills in whatever the moderator left out.
+	if params.ReportID != nil {
+		dbReport, err := cfg.queries.GetReport(context.Background(), *params.ReportID)
+		if errors.Is(err, sql.ErrNoRows) {
+			w.WriteHeader(404)
+			return
+		}
+		if err != nil {
+			requestLogger(req).Error("Error getting report", "error", err)
+			w.WriteHeader(500)
+			return
+		}
+		if dbReport.Status != reportOpen {
+			respondWithError(w, 409, errReportResolved.Error())
+			return
+		}
+		actionParams.ReportID = uuid.NullUUID{UUID: dbReport.ID, Valid: true}
+		if !actionParams.TargetUserID.Valid {
+			actionParams.TargetUserID = uuid.NullUUID{UUID: dbReport.TargetUserID, Valid: true}
+		}
+		if !actionParams.ChirpID.Valid {
+			actionParams.ChirpID = dbReport.ChirpID
+		}
+	}
+
+	switch params.Action {
+	case actionDismiss:
+		if !actionParams.ReportID.Valid {
+			respondWithError(w, 400, "A report is required")
+			return
+		}
+	case actionHideChirp, actionDeleteChirp:
+		if !actionParams.ChirpID.Valid {
+			respondWithError(w, 400, "A chirp is required")
+			return
+		}
+		dbChirp, err := cfg.queries.GetChirpForModeration(context.Background(), actionParams.ChirpID.UUID)
+		if errors.Is(err, sql.ErrNoRows) {
+			w.WriteHeader(404)
+			return
+		}
+		if err != nil {
+			requestLogger(req).Error("Error getting chirp", "error", err)
+			w.WriteHeader(500)
+			return
+		}
+		actionParams.TargetUserID = uuid.NullUUID{UUID: dbChirp.UserID, Valid: true}
+	case actionWarn, actionSuspend, actionBan, actionUnsuspend:
+		if !actionParams.TargetUserID.Valid {
+			respondWithError(w, 400, "A user is required")
+			return
+		}
+		if params.Action == actionSuspend {
+			if params.DurationHours <= 0 {
+				respondWithError(w, 400, "Suspensions need a duration")
+				return
+			}
+			if params.DurationHours > maxSuspensionHours {
+				respondWithError(w, 400, "Suspensions can last at most 10 years; use a ban instead")
+				return
+			}
+			actionParams.DurationHours = sql.NullInt32{Int32: int32(params.DurationHours), Valid: true}
+		}
+	default:
+		respondWithError(w, 400, "Invalid action")
+		return
+	}
+
+	dbAction, err := cfg.applyModerationAction(actionParams, requestAuditEvent(req, audit.ActionModeration+params.Action))
+	if errors.Is(err, errReportResolved) || errors.Is(err, errBanned) || errors.Is(err, errNotSuspended) {
+		respondWithError(w, 409, err.Error())
+		return
+	}
+	if isForeignKeyViolation(err) {
+		w.WriteHeader(404)
+		return
+	}
+	if err != nil {
+		requestLogger(req).Error("Error applying moderation action", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	switch dbAction.Action {
+	case actionHideChirp, actionDeleteChirp:
+		err = cfg.broker.Publish(context.Background(), pubsub.ChirpDeleted, dbAction.TargetUserID.UUID, map[string]uuid.UUID{"id": dbAction.ChirpID.UUID})
+		if err != nil {
+			requestLogger(req).Error("Error publishing chirp deletion", "error", err)
+		}
+		cfg.queueWebhookEvent(req.Context(), dbAction.TargetUserID.UUID, eventChirpDeleted, map[string]uuid.UUID{"id": dbAction.ChirpID.UUID})
+	case actionWarn:
+		err = cfg.notifier.Notify(context.Background(), notify.Event{Recipient: dbAction.TargetUserID.UUID, Type: notify.TypeWarning, ChirpID: dbAction.ChirpID})
+		if err != nil {
+			requestLogger(req).Error("Error sending warning", "error", err)
+		}
+	}
+	respondWithJSON(w, 201, newModerationAction(dbAction))
+}
+
+// applyModerationAction carries out a validated action, logs it and resolves
+// its report in one transaction. event is completed and written to the audit
+// log in the same transaction.
+func (cfg *apiConfig) applyModerationAction(params database.CreateModerationActionParams, event audit.Event) (database.ModerationAction, error) {
+	tx, err := cfg.db.Begin()
+	if err != nil {
+		return database.ModerationAction{}, err
+	}
+	defer tx.Rollback()
+	qtx := cfg.queries.WithTx(tx)
+
+	switch params.Action {
+	case actionHideChirp:
+		err = qtx.HideChirp(context.Background(), params.ChirpID.UUID)
+	case actionDeleteChirp:
+		err = qtx.RemoveChirp(context.Background(), params.ChirpID.UUID)
+	case actionSuspend, actionBan:
+		var upserted int64
+		upserted, err = qtx.UpsertSuspension(context.Background(), database.UpsertSuspensionParams{UserID: params.TargetUserID.UUID, DurationHours: params.DurationHours})
+		if err == nil && upserted == 0 {
+			err = errBanned
+		}
+	case actionUnsuspend:
+		var deleted int64
+		deleted, err = qtx.DeleteSuspension(context.Background(), params.TargetUserID.UUID)
+		if err == nil && deleted == 0 {
+			err = errNotSuspended
+		}
+	}
+	if err != nil {
+		return database.ModerationAction{}, err
+	}
+	dbAction, err := qtx.CreateModerationAction(context.Background(), params)
+	if err != nil {
+		return database.ModerationAction{}, err
+	}
+	event.ActorID = userActor(params.ModeratorID)
+	event.TargetType, event.TargetID = "user", params.TargetUserID.UUID.String()
+	if params.Action == actionHideChirp || params.Action == actionDeleteChirp {
+		event.TargetType, event.TargetID = "chirp", params.ChirpID.UUID.String()
+	}
+	event.After = map[string]any{"moderation_action_id": dbAction.ID.String()}
+	if dbAction.ExpiresAt.Valid {
+		event.After["expires_at"] = dbAction.ExpiresAt.Time
+	}
+	err = audit.Record(context.Background(), qtx, event)
+	if err != nil {
+		return database.ModerationAction{}, err
+	}
+	if params.ReportID.Valid {
+		status := reportActioned
+		if params.Action == actionDismiss {
+			status = reportDismissed
+		}
+		resolved, err := qtx.ResolveReport(context.Background(), database.ResolveReportParams{ID: params.ReportID.UUID, Status: status, ResolvedBy: uuid.NullUUID{UUID: params.ModeratorID, Valid: true}})
+		if err != nil {
+			return database.ModerationAction{}, err
+		}
+		// Another moderator got there first.
+		if resolved == 0 {
+			return database.ModerationAction{}, errReportResolved
+		}
+	}
+	return dbAction, tx.Commit()
+}
+
+// listModerationActionsHandler pages through the moderation log, optionally
+// for one user.
+func (cfg *apiConfig) listModerationActionsHandler(w http.ResponseWriter, req *http.Request) {
+	if _, ok := cfg.requireRole(w, req, roleModerator, roleAdmin); !ok {
+		return
+	}
+	listParams := database.ListModerationActionsParams{}
+	if userID := req.URL.Query().Get("user_id"); userID != "" {
+		targetID, err := uuid.Parse(userID)
+		if err != nil {
+			respondWithError(w, 400, "Invalid user ID")
+			return
+		}
+		listParams.TargetUserID = uuid.NullUUID{UUID: targetID, Valid: true}
+	}
+	limit, offset, err := parsePagination(req)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	listParams.RowLimit = limit
+	listParams.RowOffset = offset
+	dbActions, err := cfg.queries.ListModerationActions(context.Background(), listParams)
+	if err != nil {
+		requestLogger(req).Error("Error listing moderation actions", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	actions := []ModerationAction{}
+	for _, a := range dbActions {
+		actions = append(actions, newModerationAction(a))
+	}
+	respondWithJSON(w, 200, actions)
+}
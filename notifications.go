@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/curtisbraxdale/chirpy/internal/database"
+	"github.com/curtisbraxdale/chirpy/internal/notify"
+	"github.com/google/uuid"
+)
+
+type Notification struct {
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	Type       string     `json:"type"`
+	Message    string     `json:"message"`
+	ActorID    *uuid.UUID `json:"actor_id"`
+	ActorCount int32      `json:"actor_count"`
+	ChirpID    *uuid.UUID `json:"chirp_id"`
+	Read       bool       `json:"read"`
+}
+
+func newNotification(n database.Notification) Notification {
+	notification := Notification{ID: n.ID, CreatedAt: n.CreatedAt, UpdatedAt: n.UpdatedAt, Type: n.Type, Message: notify.Message(notify.Type(n.Type), n.ActorCount), ActorCount: n.ActorCount, Read: n.ReadAt.Valid}
+	if n.ActorID.Valid {
+		notification.ActorID = &n.ActorID.UUID
+	}
+	if n.ChirpID.Valid {
+		notification.ChirpID = &n.ChirpID.UUID
+	}
+	return notification
+}
+
+func (cfg *apiConfig) getNotificationsHandler(w http.ResponseWriter, req *http.Request) {
+	type response struct {
+		UnreadCount   int64          `json:"unread_count"`
+		Notifications []Notification `json:"notifications"`
+	}
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		respondAuthError(w, req, err)
+		return
+	}
+	limit, offset, err := parsePagination(req)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	dbNotifications, err := cfg.queries.ListNotifications(context.Background(), database.ListNotificationsParams{UserID: userID, Limit: limit, Offset: offset})
+	if err != nil {
+		requestLogger(req).Error("Error listing notifications", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	unread, err := cfg.queries.CountUnreadNotifications(context.Background(), userID)
+	if err != nil {
+		requestLogger(req).Error("Error counting notifications", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	respBody := response{UnreadCount: unread, Notifications: []Notification{}}
+	for _, n := range dbNotifications {
+		respBody.Notifications = append(respBody.Notifications, newNotification(n))
+	}
+	respondWithJSON(w, 200, respBody)
+}
+
+func (cfg *apiConfig) readNotificationHandler(w http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		respondAuthError(w, req, err)
+		return
+	}
+	notificationID, err := uuid.Parse(req.PathValue("notificationID"))
+	if err != nil {
+		requestLogger(req).Warn("Error parsing uuid", "error", err)
+		w.WriteHeader(400)
+		return
+	}
+	updated, err := cfg.queries.MarkNotificationRead(context.Background(), database.MarkNotificationReadParams{ID: notificationID, UserID: userID})
+	if err != nil {
+		requestLogger(req).Error("Error marking notification read", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	if updated == 0 {
+		w.WriteHeader(404)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+func (cfg *apiConfig) readAllNotificationsHandler(w http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		respondAuthError(w, req, err)
+		return
+	}
+	err = cfg.queries.MarkAllNotificationsRead(context.Background(), userID)
+	if err != nil {
+		requestLogger(req).Error("Error marking notifications read", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	w.WriteHeader(204)
+}
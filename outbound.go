@@ -0,0 +1,456 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/curtisbraxdale/chirpy/internal/database"
+	"github.com/curtisbraxdale/chirpy/internal/webhook"
+	"github.com/google/uuid"
+)
+
+// Event types an endpoint can subscribe to. Nothing sends user.followed or
+// like.created yet; endpoints may subscribe to them ahead of time.
+const (
+	eventChirpCreated = "chirp.created"
+	eventChirpDeleted = "chirp.deleted"
+	eventUserFollowed = "user.followed"
+	eventLikeCreated  = "like.created"
+	// eventWebhookTest is only sent by the test endpoint.
+	eventWebhookTest = "webhook.test"
+)
+
+var webhookEventTypes = []string{eventChirpCreated, eventChirpDeleted, eventUserFollowed, eventLikeCreated}
+
+const (
+	maxWebhookEndpoints = 10
+	deliveryInterval    = 5 * time.Second
+	deliveryBatchSize   = 20
+	deliveryTimeout     = 10 * time.Second
+	// deliveryLease is how long a claimed delivery is hidden from other
+	// workers. It must outlast the request.
+	deliveryLease       = deliveryTimeout + time.Minute
+	maxDeliveryAttempts = 10
+	deliveryRetryBase   = 30 * time.Second
+	deliveryRetryMax    = 6 * time.Hour
+	// maxEndpointFailures is how many failed attempts in a row disable an
+	// endpoint.
+	maxEndpointFailures = 20
+)
+
+const (
+	deliveryPending   = "pending"
+	deliverySucceeded = "succeeded"
+	deliveryFailed    = "failed"
+)
+
+type WebhookEndpoint struct {
+	ID                  uuid.UUID  `json:"id"`
+	CreatedAt           time.Time  `json:"created_at"`
+	URL                 string     `json:"url"`
+	EventTypes          []string   `json:"event_types"`
+	Enabled             bool       `json:"enabled"`
+	ConsecutiveFailures int32      `json:"consecutive_failures"`
+	DisabledAt          *time.Time `json:"disabled_at"`
+	// Secret is only returned when the endpoint is created.
+	Secret string `json:"secret,omitempty"`
+}
+
+func newWebhookEndpoint(e database.WebhookEndpoint) WebhookEndpoint {
+	endpoint := WebhookEndpoint{ID: e.ID, CreatedAt: e.CreatedAt, URL: e.Url, EventTypes: e.EventTypes, Enabled: e.Enabled, ConsecutiveFailures: e.ConsecutiveFailures}
+	if e.DisabledAt.Valid {
+		endpoint.DisabledAt = &e.DisabledAt.Time
+	}
+	return endpoint
+}
+
+type WebhookDelivery struct {
+	ID             uuid.UUID  `json:"id"`
+	CreatedAt      time.Time  `json:"created_at"`
+	EventType      string     `json:"event_type"`
+	Status         string     `json:"status"`
+	Attempts       int32      `json:"attempts"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at"`
+	LastStatusCode *int32     `json:"last_status_code"`
+	LastError      string     `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+}
+
+func newWebhookDelivery(d database.WebhookDelivery) WebhookDelivery {
+	delivery := WebhookDelivery{ID: d.ID, CreatedAt: d.CreatedAt, EventType: d.EventType, Status: d.Status, Attempts: d.Attempts, LastError: d.LastError.String}
+	if d.Status == deliveryPending {
+		delivery.NextAttemptAt = &d.NextAttemptAt
+	}
+	if d.LastStatusCode.Valid {
+		delivery.LastStatusCode = &d.LastStatusCode.Int32
+	}
+	if d.DeliveredAt.Valid {
+		delivery.DeliveredAt = &d.DeliveredAt.Time
+	}
+	return delivery
+}
+
+// webhookPayload is the body of every delivery.
+type webhookPayload struct {
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+func newWebhookPayload(eventType string, data any) (json.RawMessage, error) {
+	return json.Marshal(webhookPayload{Type: eventType, CreatedAt: time.Now().UTC(), Data: data})
+}
+
+// queueWebhookEvent queues deliveries of an event about userID to their
+// subscribed endpoints. Failures are logged with ctx's logger; the event has
+// already happened.
+func (cfg *apiConfig) queueWebhookEvent(ctx context.Context, userID uuid.UUID, eventType string, data any) {
+	payload, err := newWebhookPayload(eventType, data)
+	if err != nil {
+		loggerFromContext(ctx).Error("Error encoding webhook payload", "error", err)
+		return
+	}
+	_, err = cfg.queries.QueueWebhookDeliveries(context.Background(), database.QueueWebhookDeliveriesParams{EventType: eventType, Payload: payload, UserID: userID})
+	if err != nil {
+		loggerFromContext(ctx).Error("Error queueing webhook deliveries", "error", err)
+	}
+}
+
+// validateEndpointURL returns a message for the client if the URL can't be
+// used. Plain HTTP is only allowed in development.
+func (cfg *apiConfig) validateEndpointURL(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" {
+		return "Invalid URL"
+	}
+	if parsed.Scheme != "https" && !(parsed.Scheme == "http" && cfg.platform == "dev") {
+		return "URL must use https"
+	}
+	if cfg.platform == "dev" {
+		return ""
+	}
+	// The client refuses internal addresses when dialing; this only rejects
+	// the obvious cases early.
+	host := parsed.Hostname()
+	if strings.EqualFold(host, "localhost") || strings.HasSuffix(strings.ToLower(host), ".localhost") {
+		return "URL must not point to an internal address"
+	}
+	if addr, err := netip.ParseAddr(host); err == nil && !webhook.PublicAddr(addr) {
+		return "URL must not point to an internal address"
+	}
+	return ""
+}
+
+func newWebhookSecret() (string, error) {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(key), nil
+}
+
+func (cfg *apiConfig) createWebhookEndpointHandler(w http.ResponseWriter, req *http.Request) {
+	type parameters struct {
+		URL        string   `json:"url"`
+		EventTypes []string `json:"event_types"`
+	}
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		respondAuthError(w, req, err)
+		return
+	}
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		requestLogger(req).Error("Error decoding parameters", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	if msg := cfg.validateEndpointURL(params.URL); msg != "" {
+		respondWithError(w, 400, msg)
+		return
+	}
+	if len(params.EventTypes) == 0 {
+		respondWithError(w, 400, "At least one event type is required")
+		return
+	}
+	for _, eventType := range params.EventTypes {
+		if !slices.Contains(webhookEventTypes, eventType) {
+			respondWithError(w, 400, "Unknown event type: "+eventType)
+			return
+		}
+	}
+	slices.Sort(params.EventTypes)
+	params.EventTypes = slices.Compact(params.EventTypes)
+
+	count, err := cfg.queries.CountWebhookEndpoints(context.Background(), userID)
+	if err != nil {
+		requestLogger(req).Error("Error counting webhook endpoints", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	if count >= maxWebhookEndpoints {
+		respondWithError(w, 409, "Too many webhook endpoints")
+		return
+	}
+	secret, err := newWebhookSecret()
+	if err != nil {
+		requestLogger(req).Error("Error creating webhook secret", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	endpointParams := database.CreateWebhookEndpointParams{UserID: userID, Url: params.URL, Secret: secret, EventTypes: params.EventTypes}
+	dbEndpoint, err := cfg.queries.CreateWebhookEndpoint(context.Background(), endpointParams)
+	if err != nil {
+		requestLogger(req).Error("Error creating webhook endpoint", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	endpoint := newWebhookEndpoint(dbEndpoint)
+	endpoint.Secret = dbEndpoint.Secret
+	respondWithJSON(w, 201, endpoint)
+}
+
+func (cfg *apiConfig) listWebhookEndpointsHandler(w http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		respondAuthError(w, req, err)
+		return
+	}
+	dbEndpoints, err := cfg.queries.ListWebhookEndpoints(context.Background(), userID)
+	if err != nil {
+		requestLogger(req).Error("Error listing webhook endpoints", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	endpoints := []WebhookEndpoint{}
+	for _, e := range dbEndpoints {
+		endpoints = append(endpoints, newWebhookEndpoint(e))
+	}
+	respondWithJSON(w, 200, endpoints)
+}
+
+// endpointRequest authenticates the caller and parses the endpoint ID from
+// the path, writing the error response if either fails.
+func (cfg *apiConfig) endpointRequest(w http.ResponseWriter, req *http.Request) (uuid.UUID, uuid.UUID, bool) {
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		respondAuthError(w, req, err)
+		return uuid.Nil, uuid.Nil, false
+	}
+	endpointID, err := uuid.Parse(req.PathValue("endpointID"))
+	if err != nil {
+		respondWithError(w, 400, "Invalid endpoint ID")
+		return uuid.Nil, uuid.Nil, false
+	}
+	return userID, endpointID, true
+}
+
+func (cfg *apiConfig) deleteWebhookEndpointHandler(w http.ResponseWriter, req *http.Request) {
+	userID, endpointID, ok := cfg.endpointRequest(w, req)
+	if !ok {
+		return
+	}
+	deleted, err := cfg.queries.DeleteWebhookEndpoint(context.Background(), database.DeleteWebhookEndpointParams{ID: endpointID, UserID: userID})
+	if err != nil {
+		requestLogger(req).Error("Error deleting webhook endpoint", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	if deleted == 0 {
+		w.WriteHeader(404)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+// enableWebhookEndpointHandler turns an endpoint back on after it was
+// disabled for failing. Deliveries queued before it was disabled resume.
+func (cfg *apiConfig) enableWebhookEndpointHandler(w http.ResponseWriter, req *http.Request) {
+	userID, endpointID, ok := cfg.endpointRequest(w, req)
+	if !ok {
+		return
+	}
+	dbEndpoint, err := cfg.queries.EnableWebhookEndpoint(context.Background(), database.EnableWebhookEndpointParams{ID: endpointID, UserID: userID})
+	if errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(404)
+		return
+	}
+	if err != nil {
+		requestLogger(req).Error("Error enabling webhook endpoint", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	respondWithJSON(w, 200, newWebhookEndpoint(dbEndpoint))
+}
+
+func (cfg *apiConfig) listWebhookDeliveriesHandler(w http.ResponseWriter, req *http.Request) {
+	userID, endpointID, ok := cfg.endpointRequest(w, req)
+	if !ok {
+		return
+	}
+	limit, offset, err := parsePagination(req)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	// Checks the endpoint belongs to the caller.
+	_, err = cfg.queries.GetWebhookEndpoint(context.Background(), database.GetWebhookEndpointParams{ID: endpointID, UserID: userID})
+	if errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(404)
+		return
+	}
+	if err != nil {
+		requestLogger(req).Error("Error getting webhook endpoint", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	dbDeliveries, err := cfg.queries.ListWebhookDeliveries(context.Background(), database.ListWebhookDeliveriesParams{EndpointID: endpointID, Limit: limit, Offset: offset})
+	if err != nil {
+		requestLogger(req).Error("Error listing webhook deliveries", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	deliveries := []WebhookDelivery{}
+	for _, d := range dbDeliveries {
+		deliveries = append(deliveries, newWebhookDelivery(d))
+	}
+	respondWithJSON(w, 200, deliveries)
+}
+
+// testWebhookEndpointHandler sends a test event right away and returns the
+// logged delivery. It is tried once, and works on disabled endpoints so they
+// can be checked before being enabled again.
+func (cfg *apiConfig) testWebhookEndpointHandler(w http.ResponseWriter, req *http.Request) {
+	userID, endpointID, ok := cfg.endpointRequest(w, req)
+	if !ok {
+		return
+	}
+	dbEndpoint, err := cfg.queries.GetWebhookEndpoint(context.Background(), database.GetWebhookEndpointParams{ID: endpointID, UserID: userID})
+	if errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(404)
+		return
+	}
+	if err != nil {
+		requestLogger(req).Error("Error getting webhook endpoint", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	payload, err := newWebhookPayload(eventWebhookTest, map[string]uuid.UUID{"endpoint_id": endpointID})
+	if err != nil {
+		requestLogger(req).Error("Error encoding webhook payload", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	dbDelivery, err := cfg.queries.CreateWebhookDelivery(context.Background(), database.CreateWebhookDeliveryParams{EndpointID: endpointID, EventType: eventWebhookTest, Payload: payload})
+	if err != nil {
+		requestLogger(req).Error("Error creating webhook delivery", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	dbDelivery, err = cfg.attemptDelivery(dbDelivery.ID, dbEndpoint.ID, dbEndpoint.Url, dbEndpoint.Secret, payload, 0, 1)
+	if err != nil {
+		requestLogger(req).Error("Error recording webhook delivery", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	respondWithJSON(w, 200, newWebhookDelivery(dbDelivery))
+}
+
+// runWebhookDeliveries sends queued deliveries until the context is
+// cancelled. Every replica runs one.
+func (cfg *apiConfig) runWebhookDeliveries(ctx context.Context) {
+	ticker := time.NewTicker(deliveryInterval)
+	defer ticker.Stop()
+	for {
+		for {
+			sent, err := cfg.sendDueDeliveries()
+			if err != nil {
+				slog.Error("Error sending webhook deliveries", "error", err)
+			}
+			// A full batch means more may be waiting.
+			if err != nil || sent < deliveryBatchSize {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sendDueDeliveries claims a batch of due deliveries and sends them in
+// parallel, so one slow endpoint doesn't hold up the rest.
+func (cfg *apiConfig) sendDueDeliveries() (int, error) {
+	claimParams := database.ClaimWebhookDeliveriesParams{LeaseSeconds: int64(deliveryLease.Seconds()), RowLimit: deliveryBatchSize}
+	deliveries, err := cfg.queries.ClaimWebhookDeliveries(context.Background(), claimParams)
+	if err != nil {
+		return 0, err
+	}
+	var wg sync.WaitGroup
+	for _, d := range deliveries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := cfg.attemptDelivery(d.ID, d.EndpointID, d.Url, d.Secret, d.Payload, d.Attempts, maxDeliveryAttempts)
+			if err != nil {
+				slog.Error("Error recording webhook delivery", "delivery_id", d.ID, "error", err)
+			}
+		}()
+	}
+	wg.Wait()
+	return len(deliveries), nil
+}
+
+// attemptDelivery sends a delivery and records the outcome. A failure is
+// retried with backoff until maxAttempts, and counts towards disabling the
+// endpoint.
+func (cfg *apiConfig) attemptDelivery(deliveryID, endpointID uuid.UUID, endpointURL, secret string, payload []byte, attempts int32, maxAttempts int32) (database.WebhookDelivery, error) {
+	status, sendErr := cfg.webhookClient.Send(context.Background(), endpointURL, secret, deliveryID.String(), payload)
+	attemptParams := database.RecordWebhookDeliveryAttemptParams{ID: deliveryID, Status: deliverySucceeded, LastStatusCode: sql.NullInt32{Int32: int32(status), Valid: status != 0}}
+	if sendErr == nil {
+		cfg.metrics.webhookDelivery.WithLabelValues(deliverySucceeded).Inc()
+		err := cfg.queries.RecordWebhookEndpointSuccess(context.Background(), endpointID)
+		if err != nil {
+			return database.WebhookDelivery{}, err
+		}
+		return cfg.queries.RecordWebhookDeliveryAttempt(context.Background(), attemptParams)
+	}
+
+	// Only the client's summary is stored, since last_error is shown to the
+	// endpoint's owner.
+	slog.Warn("Webhook delivery failed", "delivery_id", deliveryID, "endpoint_id", endpointID, "error", errors.Unwrap(sendErr))
+	attemptParams.LastError = sql.NullString{String: sendErr.Error(), Valid: true}
+	if attempts+1 >= maxAttempts {
+		attemptParams.Status = deliveryFailed
+		cfg.metrics.webhookDelivery.WithLabelValues(deliveryFailed).Inc()
+	} else {
+		attemptParams.Status = deliveryPending
+		cfg.metrics.webhookDelivery.WithLabelValues("retry").Inc()
+		attemptParams.RetrySeconds = webhook.Backoff(int(attempts)+1, deliveryRetryBase, deliveryRetryMax).Seconds()
+	}
+	enabled, err := cfg.queries.RecordWebhookEndpointFailure(context.Background(), database.RecordWebhookEndpointFailureParams{MaxFailures: maxEndpointFailures, ID: endpointID})
+	if err != nil {
+		return database.WebhookDelivery{}, err
+	}
+	if !enabled {
+		slog.Warn("Webhook endpoint disabled after repeated failures", "endpoint_id", endpointID)
+	}
+	return cfg.queries.RecordWebhookDeliveryAttempt(context.Background(), attemptParams)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/curtisbraxdale/chirpy/internal/audit"
+	"github.com/curtisbraxdale/chirpy/internal/database"
+	"github.com/curtisbraxdale/chirpy/internal/webhook"
+	"github.com/google/uuid"
+)
+
+// maxWebhookBodySize bounds how much of a webhook body is read before the
+// signature is checked.
+const maxWebhookBodySize = 1 << 20
+
+const sourcePolka = "polka"
+
+// polkaWebHookHandler stores the event in the inbox and acknowledges it. The
+// inbox worker applies it.
+func (cfg *apiConfig) polkaWebHookHandler(w http.ResponseWriter, req *http.Request) {
+	// The signature covers the raw body, so read it before decoding.
+	body, err := io.ReadAll(http.MaxBytesReader(w, req.Body, maxWebhookBodySize))
+	if err != nil {
+		requestLogger(req).Warn("Error reading webhook body", "error", err)
+		cfg.metrics.webhooksReceived.WithLabelValues(sourcePolka, "bad_request").Inc()
+		w.WriteHeader(400)
+		return
+	}
+	deliveryID, err := webhook.Verify(req.Header, body, cfg.polkaSecrets, cfg.polkaTolerance, time.Now())
+	if err != nil {
+		requestLogger(req).Warn("Error verifying webhook", "error", err)
+		cfg.metrics.webhooksReceived.WithLabelValues(sourcePolka, "invalid_signature").Inc()
+		w.WriteHeader(401)
+		return
+	}
+
+	params := polkaEvent{}
+	err = json.Unmarshal(body, &params)
+	if err != nil {
+		requestLogger(req).Warn("Error decoding parameters", "error", err)
+		cfg.metrics.webhooksReceived.WithLabelValues(sourcePolka, "bad_request").Inc()
+		w.WriteHeader(400)
+		return
+	}
+	// A redelivery is acknowledged the same way; the first copy is kept.
+	eventParams := database.CreateWebhookEventParams{ID: deliveryID, Source: sourcePolka, EventType: params.Event, Payload: body}
+	stored, err := cfg.queries.CreateWebhookEvent(context.Background(), eventParams)
+	if err != nil {
+		requestLogger(req).Error("Error storing webhook event", "error", err)
+		cfg.metrics.webhooksReceived.WithLabelValues(sourcePolka, "error").Inc()
+		w.WriteHeader(500)
+		return
+	}
+	outcome := "accepted"
+	if stored == 0 {
+		outcome = "duplicate"
+	}
+	cfg.metrics.webhooksReceived.WithLabelValues(sourcePolka, outcome).Inc()
+	w.WriteHeader(204)
+}
+
+// processPolkaEvent applies a stored Polka event using q, and returns the
+// user to welcome to Chirpy Red, if any.
+func processPolkaEvent(q *database.Queries, event database.WebhookEvent) (uuid.NullUUID, error) {
+	params := polkaEvent{}
+	err := json.Unmarshal(event.Payload, &params)
+	if err != nil {
+		return uuid.NullUUID{}, permanentError{err}
+	}
+	if !isSubscriptionEvent(params.Event) {
+		return uuid.NullUUID{}, nil
+	}
+	userID, err := uuid.Parse(params.Data.UserID)
+	if err != nil {
+		return uuid.NullUUID{}, permanentError{fmt.Errorf("Invalid user ID: %w", err)}
+	}
+	auditEvent := audit.Event{Action: audit.ActionBilling + params.Event}
+	err = applySubscriptionEvent(q, event.ID, userID, params, auditEvent)
+	if isForeignKeyViolation(err) {
+		return uuid.NullUUID{}, permanentError{errors.New("Unknown user")}
+	}
+	if err != nil {
+		return uuid.NullUUID{}, err
+	}
+	if params.Event == polkaUpgraded {
+		return uuid.NullUUID{UUID: userID, Valid: true}, nil
+	}
+	return uuid.NullUUID{}, nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/curtisbraxdale/chirpy/internal/database"
+	"github.com/curtisbraxdale/chirpy/internal/notify"
+	"github.com/curtisbraxdale/chirpy/internal/polkasim"
+	"github.com/curtisbraxdale/chirpy/internal/webhook"
+	"github.com/google/uuid"
+)
+
+const testPolkaSecret = "polka-test-secret"
+
+// newPolkaTest starts polkaWebHookHandler on a test server and returns a
+// simulator pointed at it. It needs a migrated, disposable database in
+// TEST_DB_URL; without one the test is skipped.
+func newPolkaTest(t *testing.T, opts polkasim.Options) (*apiConfig, *polkasim.Simulator) {
+	dbURL := os.Getenv("TEST_DB_URL")
+	if dbURL == "" {
+		t.Skip("TEST_DB_URL is not set")
+	}
+	db, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		t.Fatalf("Error connecting to database: %s", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	err = db.Ping()
+	if err != nil {
+		t.Fatalf("Error connecting to database: %s", err)
+	}
+	queries := database.New(db)
+	cfg := &apiConfig{db: db, queries: queries, notifier: notify.NewService(queries, nil), polkaSecrets: []string{testPolkaSecret}, polkaTolerance: webhook.DefaultTolerance, metrics: newMetrics(db)}
+
+	server := httptest.NewServer(http.HandlerFunc(cfg.polkaWebHookHandler))
+	t.Cleanup(server.Close)
+	opts.URL = server.URL
+	opts.Secrets = []string{testPolkaSecret}
+	opts.RetryBase = time.Millisecond
+	return cfg, polkasim.New(opts)
+}
+
+func createPolkaTestUser(t *testing.T, cfg *apiConfig) uuid.UUID {
+	email := "polka-" + uuid.NewString() + "@example.com"
+	dbUser, err := cfg.queries.CreateUser(context.Background(), database.CreateUserParams{Email: email, HashedPassword: "unused"})
+	if err != nil {
+		t.Fatalf("Error creating user: %s", err)
+	}
+	return dbUser.ID
+}
+
+// sendPolkaEvent sends an event through the simulator and runs the inbox
+// until it is empty.
+func sendPolkaEvent(t *testing.T, cfg *apiConfig, sim *polkasim.Simulator, event string, userID uuid.UUID) polkasim.Result {
+	result, err := sim.Send(context.Background(), polkasim.NewEvent(event, userID, time.Now().Add(subscriptionPeriod)))
+	if err != nil {
+		t.Fatalf("Error sending %s: %s", event, err)
+	}
+	for {
+		processed, err := cfg.processWebhookEvents()
+		if err != nil {
+			t.Fatalf("Error processing webhook events: %s", err)
+		}
+		if processed == 0 {
+			return result
+		}
+	}
+}
+
+func assertChirpyRed(t *testing.T, cfg *apiConfig, userID uuid.UUID, want bool) {
+	isChirpyRed, err := cfg.queries.IsChirpyRed(context.Background(), userID)
+	if err != nil {
+		t.Fatalf("Error getting subscription: %s", err)
+	}
+	if isChirpyRed != want {
+		t.Fatalf("IsChirpyRed = %t, want %t", isChirpyRed, want)
+	}
+}
+
+// TestPolkaWebhookUpgrade tests that an upgrade survives failed attempts,
+// delays and duplicates, and is applied exactly once
+func TestPolkaWebhookUpgrade(t *testing.T) {
+	cfg, sim := newPolkaTest(t, polkasim.Options{FailureRate: 0.5, Delay: 5 * time.Millisecond, Duplicates: 2, MaxAttempts: 20, Seed: 42})
+	userID := createPolkaTestUser(t, cfg)
+
+	result := sendPolkaEvent(t, cfg, sim, polkasim.EventUpgraded, userID)
+	for _, a := range result.Attempts {
+		if a.Sabotaged && a.Status != 401 {
+			t.Fatalf("Bad signature got status %d, want 401", a.Status)
+		}
+		if !a.Sabotaged && a.Status != 204 {
+			t.Fatalf("Valid delivery got status %d, want 204", a.Status)
+		}
+	}
+	var count int
+	var status string
+	err := cfg.db.QueryRow("SELECT COUNT(*), MIN(status) FROM webhook_events WHERE id = $1", result.ID).Scan(&count, &status)
+	if err != nil {
+		t.Fatalf("Error getting webhook event: %s", err)
+	}
+	if count != 1 || status != webhookProcessed {
+		t.Fatalf("Stored %d events with status %q, want 1 %s", count, status, webhookProcessed)
+	}
+	assertChirpyRed(t, cfg, userID, true)
+}
+
+func TestPolkaWebhookDowngradeAndRefund(t *testing.T) {
+	cfg, sim := newPolkaTest(t, polkasim.Options{Duplicates: 1})
+	for _, event := range []string{polkasim.EventDowngraded, polkasim.EventRefunded} {
+		userID := createPolkaTestUser(t, cfg)
+		sendPolkaEvent(t, cfg, sim, polkasim.EventUpgraded, userID)
+		assertChirpyRed(t, cfg, userID, true)
+		sendPolkaEvent(t, cfg, sim, event, userID)
+		assertChirpyRed(t, cfg, userID, false)
+	}
+}
+
+func TestPolkaWebhookRejectsBadSignature(t *testing.T) {
+	cfg, sim := newPolkaTest(t, polkasim.Options{FailureRate: 1, MaxAttempts: 3})
+	userID := createPolkaTestUser(t, cfg)
+
+	result, err := sim.Send(context.Background(), polkasim.NewEvent(polkasim.EventUpgraded, userID, time.Time{}))
+	if !errors.Is(err, polkasim.ErrNotDelivered) {
+		t.Fatalf("Error = %v, want %s", err, polkasim.ErrNotDelivered)
+	}
+	for _, a := range result.Attempts {
+		if a.Status != 401 {
+			t.Fatalf("Status = %d, want 401", a.Status)
+		}
+	}
+	var count int
+	err = cfg.db.QueryRow("SELECT COUNT(*) FROM webhook_events WHERE id = $1", result.ID).Scan(&count)
+	if err != nil {
+		t.Fatalf("Error getting webhook event: %s", err)
+	}
+	if count != 0 {
+		t.Fatalf("Stored %d rejected events, want 0", count)
+	}
+	assertChirpyRed(t, cfg, userID, false)
+}
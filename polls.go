@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/curtisbraxdale/chirpy/internal/database"
+	"github.com/curtisbraxdale/chirpy/internal/textlen"
+	"github.com/google/uuid"
+)
+
+const (
+	minPollOptions      = 2
+	maxPollOptions      = 4
+	maxPollOptionLength = 50
+	maxPollDuration     = 7 * 24 * time.Hour
+)
+
+type Poll struct {
+	ID       uuid.UUID    `json:"id"`
+	ClosesAt time.Time    `json:"closes_at"`
+	Closed   bool         `json:"closed"`
+	Options  []PollOption `json:"options"`
+	// VotedOptionID is the viewer's vote, if any.
+	VotedOptionID *uuid.UUID `json:"voted_option_id"`
+	// TotalVotes and the option counts are left out until the viewer has
+	// voted or the poll has closed.
+	TotalVotes *int32 `json:"total_votes,omitempty"`
+}
+
+type PollOption struct {
+	ID    uuid.UUID `json:"id"`
+	Text  string    `json:"text"`
+	Votes *int32    `json:"votes,omitempty"`
+}
+
+// pollParameters is the poll part of a new chirp.
+type pollParameters struct {
+	Options  []string  `json:"options"`
+	ClosesAt time.Time `json:"closes_at"`
+}
+
+// validatePoll trims the options and returns a message for the client if the
+// poll isn't acceptable. A chirp without a poll is fine.
+func validatePoll(poll *pollParameters, now time.Time) string {
+	if poll == nil {
+		return ""
+	}
+	if len(poll.Options) < minPollOptions || len(poll.Options) > maxPollOptions {
+		return "Poll must have 2 to 4 options"
+	}
+	for i, option := range poll.Options {
+		option = strings.TrimSpace(option)
+		if option == "" || textlen.Count(option) > maxPollOptionLength {
+			return "Poll options must be 1 to 50 characters"
+		}
+		poll.Options[i] = option
+	}
+	if !poll.ClosesAt.After(now) {
+		return "Poll must close in the future"
+	}
+	if poll.ClosesAt.Sub(now) > maxPollDuration {
+		return "Poll can't run for more than 7 days"
+	}
+	return ""
+}
+
+func createPoll(q *database.Queries, chirpID uuid.UUID, poll pollParameters) error {
+	dbPoll, err := q.CreatePoll(context.Background(), database.CreatePollParams{ChirpID: chirpID, ClosesAt: poll.ClosesAt})
+	if err != nil {
+		return err
+	}
+	for i, option := range poll.Options {
+		_, err = q.CreatePollOption(context.Background(), database.CreatePollOptionParams{PollID: dbPoll.ID, Position: int32(i), Text: option})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadChirpPolls fills in the polls on a page of chirps as the viewer sees
+// them.
+func (cfg *apiConfig) loadChirpPolls(chirps []Chirp, viewerID uuid.NullUUID) error {
+	if len(chirps) == 0 {
+		return nil
+	}
+	chirpIDs := make([]uuid.UUID, len(chirps))
+	for i, c := range chirps {
+		chirpIDs[i] = c.ID
+	}
+	dbPolls, err := cfg.queries.ListPollsForChirps(context.Background(), database.ListPollsForChirpsParams{ViewerID: viewerID, ChirpIds: chirpIDs})
+	if err != nil || len(dbPolls) == 0 {
+		return err
+	}
+	pollIDs := make([]uuid.UUID, len(dbPolls))
+	for i, p := range dbPolls {
+		pollIDs[i] = p.ID
+	}
+	dbOptions, err := cfg.queries.ListPollOptions(context.Background(), pollIDs)
+	if err != nil {
+		return err
+	}
+	options := map[uuid.UUID][]database.PollOption{}
+	for _, o := range dbOptions {
+		options[o.PollID] = append(options[o.PollID], o)
+	}
+	polls := map[uuid.UUID]*Poll{}
+	for _, p := range dbPolls {
+		polls[p.ChirpID] = newPoll(p, options[p.ID], time.Now())
+	}
+	for i := range chirps {
+		chirps[i].Poll = polls[chirps[i].ID]
+	}
+	return nil
+}
+
+func newPoll(p database.ListPollsForChirpsRow, options []database.PollOption, now time.Time) *Poll {
+	poll := Poll{ID: p.ID, ClosesAt: p.ClosesAt, Closed: !p.ClosesAt.After(now), Options: []PollOption{}}
+	if p.VotedOptionID.Valid {
+		poll.VotedOptionID = &p.VotedOptionID.UUID
+	}
+	showResults := poll.Closed || p.VotedOptionID.Valid
+	total := int32(0)
+	for _, o := range options {
+		option := PollOption{ID: o.ID, Text: o.Text}
+		if showResults {
+			votes := o.VoteCount
+			option.Votes = &votes
+		}
+		total += o.VoteCount
+		poll.Options = append(poll.Options, option)
+	}
+	if showResults {
+		poll.TotalVotes = &total
+	}
+	return &poll
+}
+
+func (cfg *apiConfig) votePollHandler(w http.ResponseWriter, req *http.Request) {
+	type parameters struct {
+		OptionID uuid.UUID `json:"option_id"`
+	}
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		respondAuthError(w, req, err)
+		return
+	}
+	pollID, err := uuid.Parse(req.PathValue("pollID"))
+	if err != nil {
+		respondWithError(w, 400, "Invalid poll ID")
+		return
+	}
+	decoder := json.NewDecoder(req.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		requestLogger(req).Error("Error decoding parameters", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	dbPoll, err := cfg.queries.GetPoll(context.Background(), pollID)
+	if errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(404)
+		return
+	}
+	if err != nil {
+		requestLogger(req).Error("Error getting poll", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	dbChirp, err := cfg.queries.GetChirp(context.Background(), dbPoll.ChirpID)
+	if errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(404)
+		return
+	}
+	if err != nil {
+		requestLogger(req).Error("Error getting chirp", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	blocked, err := cfg.queries.HasBlock(context.Background(), database.HasBlockParams{BlockerID: userID, BlockedID: dbChirp.UserID})
+	if err != nil {
+		requestLogger(req).Error("Error checking blocks", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	if blocked {
+		w.WriteHeader(404)
+		return
+	}
+
+	voted, err := cfg.queries.VotePoll(context.Background(), database.VotePollParams{UserID: userID, PollID: pollID, OptionID: params.OptionID})
+	if err != nil {
+		requestLogger(req).Error("Error voting in poll", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	chirps := []Chirp{{ID: dbChirp.ID}}
+	err = cfg.loadChirpPolls(chirps, uuid.NullUUID{UUID: userID, Valid: true})
+	if err != nil {
+		requestLogger(req).Error("Error getting poll", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	poll := chirps[0].Poll
+	if voted == 0 {
+		// Work out why the vote wasn't counted.
+		switch {
+		case poll.VotedOptionID != nil:
+			respondWithError(w, 409, "Already voted")
+		case poll.Closed:
+			respondWithError(w, 409, "Poll is closed")
+		default:
+			respondWithError(w, 400, "Invalid option")
+		}
+		return
+	}
+	respondWithJSON(w, 200, poll)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strings"
+
+	"github.com/curtisbraxdale/chirpy/internal/database"
+	"github.com/curtisbraxdale/chirpy/internal/search"
+	"github.com/google/uuid"
+)
+
+type UserSummary struct {
+	ID          uuid.UUID `json:"id"`
+	Handle      string    `json:"handle"`
+	DisplayName string    `json:"display_name"`
+}
+
+func (cfg *apiConfig) searchChirpsHandler(w http.ResponseWriter, req *http.Request) {
+	query, err := search.Parse(req.URL.Query().Get("q"))
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	if query.IsEmpty() {
+		respondWithError(w, 400, "Search query is empty")
+		return
+	}
+	limit, offset, err := parsePagination(req)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	searchParams := database.SearchChirpsParams{
+		Query:     query.Text,
+		Handle:    sql.NullString{String: query.From, Valid: query.From != ""},
+		Since:     sql.NullTime{Time: query.Since, Valid: !query.Since.IsZero()},
+		Until:     sql.NullTime{Time: query.Until, Valid: !query.Until.IsZero()},
+		ViewerID:  cfg.optionalUserID(req),
+		RowLimit:  limit,
+		RowOffset: offset,
+	}
+	dbChirps, err := cfg.queries.SearchChirps(context.Background(), searchParams)
+	if err != nil {
+		requestLogger(req).Error("Error searching chirps", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	// Results are already ordered by rank.
+	chirps := []Chirp{}
+	for _, c := range dbChirps {
+		chirps = append(chirps, Chirp{ID: c.ID, CreatedAt: c.CreatedAt, UpdatedAt: c.UpdatedAt, Body: c.Body, UserID: c.UserID})
+	}
+	err = cfg.loadChirpDetails(chirps, searchParams.ViewerID)
+	if err != nil {
+		requestLogger(req).Error("Error getting chirp details", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	respondWithJSON(w, 200, chirps)
+}
+
+func (cfg *apiConfig) searchUsersHandler(w http.ResponseWriter, req *http.Request) {
+	q := strings.TrimSpace(req.URL.Query().Get("q"))
+	if q == "" {
+		respondWithError(w, 400, "Search query is empty")
+		return
+	}
+	limit, offset, err := parsePagination(req)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	// Also match handles by prefix so partially typed handles find users.
+	prefix := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(strings.TrimPrefix(q, "@")) + "%"
+	searchParams := database.SearchUsersParams{Query: q, HandlePrefix: prefix, ViewerID: cfg.optionalUserID(req), RowLimit: limit, RowOffset: offset}
+	dbUsers, err := cfg.queries.SearchUsers(context.Background(), searchParams)
+	if err != nil {
+		requestLogger(req).Error("Error searching users", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	users := []UserSummary{}
+	for _, u := range dbUsers {
+		users = append(users, UserSummary{ID: u.ID, Handle: u.Handle.String, DisplayName: u.DisplayName})
+	}
+	respondWithJSON(w, 200, users)
+}
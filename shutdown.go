@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// workerGroup runs background workers with a shared context, so they can be
+// stopped together and waited for.
+type workerGroup struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newWorkerGroup() *workerGroup {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &workerGroup{ctx: ctx, cancel: cancel}
+}
+
+func (g *workerGroup) Go(run func(context.Context)) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		run(g.ctx)
+	}()
+}
+
+// Stop cancels the workers and waits for them to finish what they are doing,
+// up to the deadline. It reports whether they all finished.
+func (g *workerGroup) Stop(deadline time.Time) bool {
+	g.cancel()
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	select {
+	case <-done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// shutdownServer fails readiness checks, waits drainDelay for load balancers
+// to notice, then stops accepting connections and lets in-flight requests
+// finish. Streams are told to go away so their clients reconnect elsewhere.
+// After that the workers are stopped, with their own drainTimeout, so a slow
+// drain can't leave them no time. The database is only closed once they have
+// all finished, since closing it mid-transaction would fail their work.
+func (cfg *apiConfig) shutdownServer(server *http.Server, workers *workerGroup, drainDelay, drainTimeout time.Duration) {
+	cfg.draining.Store(true)
+	slog.Info("Shutting down", "drain_delay", drainDelay.String())
+	time.Sleep(drainDelay)
+
+	deadline := time.Now().Add(drainTimeout)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	server.RegisterOnShutdown(func() { close(cfg.shutdown) })
+	err := server.Shutdown(ctx)
+	if err != nil {
+		slog.Error("Error draining connections", "error", err)
+		server.Close()
+	}
+	if !workers.Stop(time.Now().Add(drainTimeout)) {
+		slog.Warn("Background workers didn't stop in time; leaving the database open")
+		return
+	}
+	err = cfg.db.Close()
+	if err != nil {
+		slog.Error("Error closing database", "error", err)
+	}
+	slog.Info("Shutdown complete")
+}
@@ -0,0 +1,50 @@
+-- name: CreateBlock :exec
+INSERT INTO blocks (blocker_id, blocked_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT DO NOTHING;
+
+-- name: DeleteBlock :exec
+DELETE FROM blocks WHERE blocker_id = $1 AND blocked_id = $2;
+
+-- name: HasBlock :one
+SELECT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocker_id = $1 AND blocked_id = $2) OR (blocker_id = $2 AND blocked_id = $1)
+);
+
+-- name: ListBlocks :many
+SELECT users.id, users.handle, users.display_name, blocks.created_at
+FROM blocks
+JOIN users ON users.id = blocks.blocked_id
+WHERE blocks.blocker_id = $1
+ORDER BY blocks.created_at DESC
+LIMIT $2 OFFSET $3;
+
+-- name: CreateMute :exec
+INSERT INTO mutes (muter_id, muted_id, created_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT DO NOTHING;
+
+-- name: DeleteMute :exec
+DELETE FROM mutes WHERE muter_id = $1 AND muted_id = $2;
+
+-- name: HasMute :one
+SELECT EXISTS (
+    SELECT 1 FROM mutes WHERE muter_id = $1 AND muted_id = $2
+);
+
+-- name: ListMutes :many
+SELECT users.id, users.handle, users.display_name, mutes.created_at
+FROM mutes
+JOIN users ON users.id = mutes.muted_id
+WHERE mutes.muter_id = $1
+ORDER BY mutes.created_at DESC
+LIMIT $2 OFFSET $3;
+
+-- name: GetBlockedUserIDs :many
+SELECT blocked_id AS user_id FROM blocks WHERE blocks.blocker_id = $1
+UNION
+SELECT blocker_id AS user_id FROM blocks WHERE blocks.blocked_id = $1;
+
+-- name: GetMutedUserIDs :many
+SELECT muted_id FROM mutes WHERE muter_id = $1;
@@ -1,25 +1,92 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, body_hash)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
+    $2,
+    $3
 )
 RETURNING *;
 
+-- name: LockAuthorChirps :exec
+-- Serializes chirp creation per author until the transaction ends, so two
+-- identical chirps posted at once can't both pass the duplicate check.
+SELECT pg_advisory_xact_lock(hashtext(@user_id::text));
+
+-- name: HasRecentDuplicate :one
+SELECT EXISTS (
+    SELECT 1 FROM chirps
+    WHERE user_id = $1 AND body_hash = $2 AND created_at > NOW() - @window_seconds::bigint * INTERVAL '1 second' AND deleted_at IS NULL
+);
+
 -- name: DeleteChirps :exec
 DELETE FROM chirps;
 
--- name: DeleteChirp :exec
-DELETE FROM chirps WHERE id = $1;
+-- name: SoftDeleteChirp :execrows
+UPDATE chirps SET deleted_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL;
+
+-- name: RestoreChirp :one
+UPDATE chirps SET deleted_at = NULL
+WHERE id = $1 AND user_id = $2 AND deleted_at > NOW() - @restore_seconds::bigint * INTERVAL '1 second' AND hidden_at IS NULL
+RETURNING *;
+
+-- name: ListDeletedChirps :many
+SELECT * FROM chirps
+WHERE user_id = $1 AND deleted_at > NOW() - @restore_seconds::bigint * INTERVAL '1 second' AND hidden_at IS NULL
+ORDER BY deleted_at DESC;
+
+-- name: PurgeDeletedChirps :many
+-- Hard-deletes chirps past the restore window. Their media rows are deleted
+-- here instead of by the cascade, in the same statement, so the stored files
+-- can be removed too. Chirps without media come back with null keys.
+WITH purged AS (
+    DELETE FROM chirps WHERE deleted_at <= NOW() - @restore_seconds::bigint * INTERVAL '1 second'
+    RETURNING id
+), purged_media AS (
+    DELETE FROM media USING purged WHERE media.chirp_id = purged.id
+    RETURNING media.chirp_id, media.storage_key, media.thumbnail_key
+)
+SELECT purged.id, purged_media.storage_key, purged_media.thumbnail_key
+FROM purged LEFT JOIN purged_media ON purged_media.chirp_id = purged.id;
 
 -- name: GetChirps :many
-SELECT * FROM chirps ORDER BY created_at ASC;
+SELECT * FROM chirps
+WHERE deleted_at IS NULL AND hidden_at IS NULL
+AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocks.blocker_id = sqlc.narg('viewer_id') AND blocks.blocked_id = chirps.user_id)
+        OR (blocks.blocker_id = chirps.user_id AND blocks.blocked_id = sqlc.narg('viewer_id'))
+)
+AND NOT EXISTS (
+    SELECT 1 FROM mutes WHERE mutes.muter_id = sqlc.narg('viewer_id') AND mutes.muted_id = chirps.user_id
+)
+ORDER BY created_at ASC;
 
 -- name: GetChirpsByUser :many
-SELECT * FROM chirps WHERE user_id = $1 ORDER BY created_at ASC;
+SELECT * FROM chirps
+WHERE user_id = $1
+AND deleted_at IS NULL AND hidden_at IS NULL
+AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocks.blocker_id = sqlc.narg('viewer_id') AND blocks.blocked_id = chirps.user_id)
+        OR (blocks.blocker_id = chirps.user_id AND blocks.blocked_id = sqlc.narg('viewer_id'))
+)
+ORDER BY created_at ASC;
 
 -- name: GetChirp :one
+SELECT * FROM chirps WHERE id = $1 AND deleted_at IS NULL AND hidden_at IS NULL;
+
+-- name: GetChirpForModeration :one
 SELECT * FROM chirps WHERE id = $1;
+
+-- name: HideChirp :exec
+UPDATE chirps SET hidden_at = COALESCE(hidden_at, NOW())
+WHERE id = $1;
+
+-- name: RemoveChirp :exec
+-- Deleted by a moderator: hidden as well, so the author can't restore it.
+UPDATE chirps SET hidden_at = COALESCE(hidden_at, NOW()), deleted_at = COALESCE(deleted_at, NOW())
+WHERE id = $1;
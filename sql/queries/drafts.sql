@@ -0,0 +1,48 @@
+-- name: CreateDraft :one
+-- publish_at is converted from an absolute time to the server's time zone, so
+-- it compares correctly with NOW() when due drafts are listed.
+INSERT INTO drafts (id, created_at, updated_at, user_id, body, publish_at)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    @user_id,
+    @body,
+    sqlc.narg(publish_at)::timestamptz
+)
+RETURNING *;
+
+-- name: GetDraft :one
+SELECT * FROM drafts WHERE id = $1 AND user_id = $2;
+
+-- name: ListDrafts :many
+SELECT * FROM drafts
+WHERE user_id = $1 AND publish_at IS NULL
+ORDER BY updated_at DESC;
+
+-- name: ListScheduledDrafts :many
+SELECT * FROM drafts
+WHERE user_id = $1 AND publish_at IS NOT NULL
+ORDER BY publish_at ASC;
+
+-- name: UpdateDraft :one
+UPDATE drafts SET body = @body, publish_at = sqlc.narg(publish_at)::timestamptz, publish_error = NULL, updated_at = NOW()
+WHERE id = @id AND user_id = @user_id
+RETURNING *;
+
+-- name: DeleteDraft :execrows
+DELETE FROM drafts WHERE id = $1 AND user_id = $2;
+
+-- name: ListDueDrafts :many
+-- Locks the due drafts for this transaction. Drafts already locked by
+-- another scheduler are skipped rather than waited on, so each one is
+-- published by exactly one replica.
+SELECT * FROM drafts
+WHERE publish_at <= NOW()
+ORDER BY publish_at ASC
+LIMIT $1
+FOR UPDATE SKIP LOCKED;
+
+-- name: FailDraft :exec
+UPDATE drafts SET publish_at = NULL, publish_error = $2, updated_at = NOW()
+WHERE id = $1;
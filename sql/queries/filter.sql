@@ -0,0 +1,33 @@
+-- name: ListFilterRules :many
+SELECT * FROM filter_rules ORDER BY term ASC;
+
+-- name: UpsertFilterRule :one
+INSERT INTO filter_rules (id, created_at, term, action)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2
+)
+ON CONFLICT (term) DO UPDATE SET action = EXCLUDED.action
+RETURNING *;
+
+-- name: DeleteFilterRule :one
+DELETE FROM filter_rules WHERE id = $1
+RETURNING *;
+
+-- name: CreateContentFlag :exec
+INSERT INTO content_flags (id, created_at, chirp_id, terms)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2
+);
+
+-- name: ListContentFlags :many
+SELECT content_flags.id, content_flags.created_at, content_flags.chirp_id, content_flags.terms, chirps.body, chirps.user_id
+FROM content_flags
+JOIN chirps ON chirps.id = content_flags.chirp_id
+ORDER BY content_flags.created_at DESC
+LIMIT $1 OFFSET $2;
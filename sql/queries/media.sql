@@ -0,0 +1,29 @@
+-- name: CreateMedia :one
+INSERT INTO media (id, created_at, user_id, content_type, storage_key, thumbnail_key, width, height, size_bytes)
+VALUES (
+    $1,
+    NOW(),
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8
+)
+RETURNING *;
+
+-- name: AttachMedia :execrows
+UPDATE media SET chirp_id = @chirp_id, position = @position
+WHERE id = @id AND user_id = @user_id AND chirp_id IS NULL;
+
+-- name: DeleteUnattachedMedia :many
+-- Removes uploads that were never attached to a chirp.
+DELETE FROM media
+WHERE chirp_id IS NULL AND created_at <= NOW() - @max_age_seconds::bigint * INTERVAL '1 second'
+RETURNING storage_key, thumbnail_key;
+
+-- name: ListMediaForChirps :many
+SELECT * FROM media
+WHERE chirp_id = ANY(@chirp_ids::uuid[])
+ORDER BY chirp_id, position;
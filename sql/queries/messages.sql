@@ -0,0 +1,85 @@
+-- name: CreateConversation :one
+INSERT INTO conversations (id, created_at, updated_at)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW()
+)
+RETURNING *;
+
+-- name: AddConversationParticipant :exec
+INSERT INTO conversation_participants (conversation_id, user_id, joined_at)
+VALUES ($1, $2, NOW());
+
+-- name: LockDirectConversation :exec
+-- Serializes finding or starting a conversation between two users until the
+-- transaction ends, so two requests can't both start one.
+SELECT pg_advisory_xact_lock(hashtext(LEAST(@first_user_id::uuid, @second_user_id::uuid)::text || GREATEST(@first_user_id::uuid, @second_user_id::uuid)::text));
+
+-- name: FindDirectConversation :one
+-- Only looks at the first user's conversations rather than grouping every
+-- conversation's participants.
+SELECT conversations.id, conversations.created_at, conversations.updated_at
+FROM conversations
+JOIN conversation_participants ON conversation_participants.conversation_id = conversations.id
+WHERE conversations.id IN (
+    SELECT conversation_id FROM conversation_participants WHERE user_id = @first_user_id::uuid
+)
+GROUP BY conversations.id
+HAVING COUNT(*) = 2
+    AND bool_or(conversation_participants.user_id = @first_user_id::uuid)
+    AND bool_or(conversation_participants.user_id = @second_user_id::uuid)
+LIMIT 1;
+
+-- name: GetConversationParticipantIDs :many
+SELECT user_id FROM conversation_participants
+WHERE conversation_id = $1
+ORDER BY joined_at ASC;
+
+-- name: ListConversations :many
+SELECT conversations.id, conversations.created_at, conversations.updated_at,
+    (SELECT array_agg(p.user_id ORDER BY p.joined_at) FROM conversation_participants p WHERE p.conversation_id = conversations.id)::uuid[] AS participant_ids,
+    last_message.id AS last_message_id,
+    last_message.sender_id AS last_message_sender_id,
+    last_message.body AS last_message_body,
+    last_message.created_at AS last_message_created_at,
+    (SELECT COUNT(*) FROM messages unread
+        WHERE unread.conversation_id = conversations.id
+        AND unread.sender_id <> @user_id
+        AND (me.last_read_at IS NULL OR unread.created_at > me.last_read_at)) AS unread_count
+FROM conversation_participants me
+JOIN conversations ON conversations.id = me.conversation_id
+LEFT JOIN LATERAL (
+    SELECT * FROM messages
+    WHERE messages.conversation_id = conversations.id
+    ORDER BY messages.created_at DESC
+    LIMIT 1
+) last_message ON true
+WHERE me.user_id = @user_id
+ORDER BY conversations.updated_at DESC
+LIMIT @row_limit OFFSET @row_offset;
+
+-- name: CreateMessage :one
+INSERT INTO messages (id, created_at, conversation_id, sender_id, body)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3
+)
+RETURNING *;
+
+-- name: TouchConversation :exec
+UPDATE conversations SET updated_at = NOW() WHERE id = $1;
+
+-- name: ListMessages :many
+SELECT * FROM messages
+WHERE conversation_id = $1
+ORDER BY created_at DESC
+LIMIT $2 OFFSET $3;
+
+-- name: MarkConversationRead :execrows
+UPDATE conversation_participants
+SET last_read_at = NOW()
+WHERE conversation_id = $1 AND user_id = $2;
@@ -0,0 +1,68 @@
+-- name: CreateReport :one
+INSERT INTO reports (id, created_at, reporter_id, target_user_id, chirp_id, reason, details)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5
+)
+RETURNING *;
+
+-- name: GetReport :one
+SELECT * FROM reports WHERE id = $1;
+
+-- name: ListReports :many
+-- Oldest first, so the queue is worked in order. The chirp body is included
+-- even if the chirp has since been hidden or deleted.
+SELECT reports.*, chirps.body
+FROM reports
+LEFT JOIN chirps ON chirps.id = reports.chirp_id
+WHERE reports.status = $1
+ORDER BY reports.created_at ASC
+LIMIT $2 OFFSET $3;
+
+-- name: ResolveReport :execrows
+UPDATE reports SET status = $2, resolved_at = NOW(), resolved_by = $3
+WHERE id = $1 AND status = 'open';
+
+-- name: CreateModerationAction :one
+-- expires_at is worked out here, like suspensions.until, so both use the
+-- database's clock and time zone.
+INSERT INTO moderation_actions (id, created_at, moderator_id, action, report_id, target_user_id, chirp_id, note, expires_at)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    @moderator_id,
+    @action,
+    @report_id,
+    @target_user_id,
+    @chirp_id,
+    @note,
+    NOW() + sqlc.narg(duration_hours)::int * INTERVAL '1 hour'
+)
+RETURNING *;
+
+-- name: ListModerationActions :many
+SELECT * FROM moderation_actions
+WHERE sqlc.narg('target_user_id')::uuid IS NULL OR target_user_id = sqlc.narg('target_user_id')
+ORDER BY created_at DESC
+LIMIT @row_limit OFFSET @row_offset;
+
+-- name: UpsertSuspension :execrows
+-- A NULL duration is a ban. A timed suspension doesn't replace a ban, which
+-- has to be lifted first.
+INSERT INTO suspensions (user_id, created_at, until)
+VALUES (@user_id, NOW(), NOW() + sqlc.narg(duration_hours)::int * INTERVAL '1 hour')
+ON CONFLICT (user_id) DO UPDATE SET created_at = NOW(), until = EXCLUDED.until
+WHERE suspensions.until IS NOT NULL OR EXCLUDED.until IS NULL;
+
+-- name: DeleteSuspension :execrows
+DELETE FROM suspensions WHERE user_id = $1 AND (until IS NULL OR until > NOW());
+
+-- name: IsSuspended :one
+SELECT EXISTS (
+    SELECT 1 FROM suspensions WHERE user_id = $1 AND (until IS NULL OR until > NOW())
+);
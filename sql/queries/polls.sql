@@ -0,0 +1,51 @@
+-- name: CreatePoll :one
+-- closes_at is converted from an absolute time to the server's time zone, so
+-- it compares correctly with NOW() when votes are cast.
+INSERT INTO polls (id, created_at, chirp_id, closes_at)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    @chirp_id,
+    @closes_at::timestamptz
+)
+RETURNING *;
+
+-- name: CreatePollOption :one
+INSERT INTO poll_options (id, poll_id, position, text)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    $3
+)
+RETURNING *;
+
+-- name: GetPoll :one
+SELECT * FROM polls WHERE id = $1;
+
+-- name: ListPollsForChirps :many
+SELECT polls.id, polls.created_at, polls.chirp_id, polls.closes_at, poll_votes.option_id AS voted_option_id
+FROM polls
+LEFT JOIN poll_votes ON poll_votes.poll_id = polls.id AND poll_votes.user_id = sqlc.narg('viewer_id')
+WHERE polls.chirp_id = ANY(@chirp_ids::uuid[]);
+
+-- name: ListPollOptions :many
+SELECT * FROM poll_options
+WHERE poll_id = ANY(@poll_ids::uuid[])
+ORDER BY poll_id, position;
+
+-- name: VotePoll :execrows
+-- Records the vote and bumps the option's count in one statement, so
+-- concurrent votes can't double count. Nothing happens if the user has
+-- already voted, the option isn't in the poll, or the poll has closed.
+WITH vote AS (
+    INSERT INTO poll_votes (poll_id, user_id, option_id, created_at)
+    SELECT polls.id, @user_id::uuid, poll_options.id, NOW()
+    FROM polls
+    JOIN poll_options ON poll_options.poll_id = polls.id
+    WHERE polls.id = @poll_id AND poll_options.id = @option_id AND polls.closes_at > NOW()
+    ON CONFLICT (poll_id, user_id) DO NOTHING
+    RETURNING option_id
+)
+UPDATE poll_options SET vote_count = vote_count + 1
+WHERE id IN (SELECT option_id FROM vote);
@@ -0,0 +1,5 @@
+-- name: HasRole :one
+-- Reports whether the user has any of the roles.
+SELECT EXISTS (
+    SELECT 1 FROM user_roles WHERE user_id = $1 AND role = ANY(@roles::text[])
+);
@@ -0,0 +1,31 @@
+-- name: SearchChirps :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id,
+    ts_rank(to_tsvector('english', chirps.body), websearch_to_tsquery('english', @query::text)) AS rank
+FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE chirps.deleted_at IS NULL AND chirps.hidden_at IS NULL
+    AND (@query::text = '' OR to_tsvector('english', chirps.body) @@ websearch_to_tsquery('english', @query::text))
+    AND (sqlc.narg('handle')::text IS NULL OR users.handle = sqlc.narg('handle')::text)
+    AND (sqlc.narg('since')::timestamp IS NULL OR chirps.created_at >= sqlc.narg('since')::timestamp)
+    AND (sqlc.narg('until')::timestamp IS NULL OR chirps.created_at < sqlc.narg('until')::timestamp)
+    AND NOT EXISTS (
+        SELECT 1 FROM blocks
+        WHERE (blocks.blocker_id = sqlc.narg('viewer_id') AND blocks.blocked_id = chirps.user_id)
+            OR (blocks.blocker_id = chirps.user_id AND blocks.blocked_id = sqlc.narg('viewer_id'))
+    )
+ORDER BY rank DESC, chirps.created_at DESC
+LIMIT @row_limit OFFSET @row_offset;
+
+-- name: SearchUsers :many
+SELECT id, handle, display_name,
+    ts_rank(to_tsvector('simple', coalesce(handle, '') || ' ' || display_name), websearch_to_tsquery('simple', @query::text)) AS rank
+FROM users
+WHERE (to_tsvector('simple', coalesce(handle, '') || ' ' || display_name) @@ websearch_to_tsquery('simple', @query::text)
+        OR handle ILIKE @handle_prefix::text)
+    AND NOT EXISTS (
+        SELECT 1 FROM blocks
+        WHERE (blocks.blocker_id = sqlc.narg('viewer_id') AND blocks.blocked_id = users.id)
+            OR (blocks.blocker_id = users.id AND blocks.blocked_id = sqlc.narg('viewer_id'))
+    )
+ORDER BY rank DESC, handle ASC
+LIMIT @row_limit OFFSET @row_offset;
@@ -0,0 +1,21 @@
+-- name: CreateStreamEvent :one
+INSERT INTO stream_events (created_at, type, user_id, payload)
+VALUES (
+    NOW(),
+    $1,
+    $2,
+    $3
+)
+RETURNING *;
+
+-- name: ListStreamEventsAfter :many
+SELECT * FROM stream_events
+WHERE id > $1
+ORDER BY id ASC
+LIMIT $2;
+
+-- name: DeleteStreamEventsOlderThan :exec
+DELETE FROM stream_events WHERE created_at < NOW() - @retention_seconds::bigint * INTERVAL '1 second';
+
+-- name: NotifyStreamSignal :exec
+SELECT pg_notify('stream_signals', @payload::text);
@@ -0,0 +1,60 @@
+-- name: GetSubscription :one
+SELECT * FROM subscriptions WHERE user_id = $1;
+
+-- name: UpsertSubscription :one
+-- Starts a subscription, or restarts the user's existing one. The period
+-- ends at period_end if Polka gave one, or period_seconds after it starts. A
+-- renewal starts at the end of the paid period if that hasn't passed yet.
+INSERT INTO subscriptions (id, created_at, updated_at, user_id, plan, status, current_period_start, current_period_end, cancel_at_period_end)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    @user_id,
+    @plan,
+    'active',
+    NOW(),
+    COALESCE(sqlc.narg(period_end)::timestamptz, NOW() + @period_seconds::bigint * INTERVAL '1 second'),
+    false
+)
+ON CONFLICT (user_id) DO UPDATE SET
+    updated_at = NOW(),
+    plan = EXCLUDED.plan,
+    status = 'active',
+    current_period_start = CASE
+        WHEN @renewal::boolean AND subscriptions.current_period_end > NOW() THEN subscriptions.current_period_end
+        ELSE NOW()
+    END,
+    current_period_end = COALESCE(sqlc.narg(period_end)::timestamptz, CASE
+        WHEN @renewal::boolean AND subscriptions.current_period_end > NOW() THEN subscriptions.current_period_end
+        ELSE NOW()
+    END + @period_seconds::bigint * INTERVAL '1 second'),
+    cancel_at_period_end = false
+RETURNING *;
+
+-- name: MarkSubscriptionPastDue :execrows
+UPDATE subscriptions SET status = 'past_due', updated_at = NOW()
+WHERE user_id = $1 AND status = 'active';
+
+-- name: CancelSubscriptionAtPeriodEnd :execrows
+UPDATE subscriptions SET cancel_at_period_end = true, updated_at = NOW()
+WHERE user_id = $1 AND status IN ('active', 'past_due');
+
+-- name: EndSubscription :execrows
+-- Ends the subscription now, with status canceled or refunded.
+UPDATE subscriptions SET status = $2, current_period_end = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND status IN ('active', 'past_due');
+
+-- name: ExpireSubscriptions :execrows
+UPDATE subscriptions
+SET status = CASE WHEN cancel_at_period_end THEN 'canceled' ELSE 'expired' END, updated_at = NOW()
+WHERE status IN ('active', 'past_due') AND current_period_end <= NOW();
+
+-- name: IsChirpyRed :one
+-- Checks the period as well as the status, so a lapsed subscription stops
+-- counting before the expiry job gets to it.
+SELECT EXISTS (
+    SELECT 1 FROM subscriptions
+    WHERE user_id = $1 AND status IN ('active', 'past_due')
+        AND current_period_end > NOW()
+);
@@ -1,11 +1,13 @@
 -- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, email, hashed_password)
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, handle, display_name)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
+    $2,
+    $3,
+    $4
 )
 RETURNING *;
 
@@ -22,6 +24,6 @@ SELECT * FROM users WHERE id = $1;
 UPDATE users
 SET email = $2, hashed_password = $3, updated_at = NOW() WHERE id = $1;
 
--- name: UpgradeUser :exec
+-- name: UpdateProfile :exec
 UPDATE users
-SET is_chirpy_red = true, updated_at = NOW() WHERE id = $1;
+SET handle = $2, display_name = $3, updated_at = NOW() WHERE id = $1;
@@ -0,0 +1,98 @@
+-- name: CreateWebhookEndpoint :one
+INSERT INTO webhook_endpoints (id, created_at, updated_at, user_id, url, secret, event_types)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4
+)
+RETURNING *;
+
+-- name: CountWebhookEndpoints :one
+SELECT COUNT(*) FROM webhook_endpoints WHERE user_id = $1;
+
+-- name: GetWebhookEndpoint :one
+SELECT * FROM webhook_endpoints WHERE id = $1 AND user_id = $2;
+
+-- name: ListWebhookEndpoints :many
+SELECT * FROM webhook_endpoints WHERE user_id = $1 ORDER BY created_at ASC;
+
+-- name: DeleteWebhookEndpoint :execrows
+DELETE FROM webhook_endpoints WHERE id = $1 AND user_id = $2;
+
+-- name: EnableWebhookEndpoint :one
+UPDATE webhook_endpoints
+SET enabled = true, consecutive_failures = 0, disabled_at = NULL, updated_at = NOW()
+WHERE id = $1 AND user_id = $2
+RETURNING *;
+
+-- name: RecordWebhookEndpointSuccess :exec
+UPDATE webhook_endpoints SET consecutive_failures = 0 WHERE id = $1;
+
+-- name: RecordWebhookEndpointFailure :one
+-- Disables the endpoint once it reaches the failure limit, and returns
+-- whether it is still enabled.
+UPDATE webhook_endpoints
+SET consecutive_failures = consecutive_failures + 1,
+    enabled = enabled AND consecutive_failures + 1 < @max_failures::integer,
+    disabled_at = CASE
+        WHEN enabled AND consecutive_failures + 1 >= @max_failures::integer THEN NOW()
+        ELSE disabled_at
+    END,
+    updated_at = NOW()
+WHERE id = @id
+RETURNING enabled;
+
+-- name: QueueWebhookDeliveries :execrows
+-- Queues the event for each of the user's enabled endpoints subscribed to
+-- it.
+INSERT INTO webhook_deliveries (id, created_at, endpoint_id, event_type, payload, next_attempt_at)
+SELECT gen_random_uuid(), NOW(), id, @event_type::text, @payload::jsonb, NOW()
+FROM webhook_endpoints
+WHERE user_id = @user_id AND enabled AND @event_type::text = ANY(event_types);
+
+-- name: CreateWebhookDelivery :one
+INSERT INTO webhook_deliveries (id, created_at, endpoint_id, event_type, payload, next_attempt_at)
+VALUES (gen_random_uuid(), NOW(), $1, $2, $3, NOW())
+RETURNING *;
+
+-- name: ClaimWebhookDeliveries :many
+-- Leases due deliveries to this worker by pushing their next attempt back,
+-- so the HTTP requests can be made outside a transaction without another
+-- replica sending the same delivery.
+UPDATE webhook_deliveries
+SET next_attempt_at = NOW() + @lease_seconds::bigint * INTERVAL '1 second'
+FROM webhook_endpoints
+WHERE webhook_endpoints.id = webhook_deliveries.endpoint_id
+    AND webhook_deliveries.id IN (
+        SELECT webhook_deliveries.id FROM webhook_deliveries
+        JOIN webhook_endpoints ON webhook_endpoints.id = webhook_deliveries.endpoint_id
+        WHERE webhook_deliveries.status = 'pending' AND webhook_deliveries.next_attempt_at <= NOW()
+            AND webhook_endpoints.enabled
+        ORDER BY webhook_deliveries.next_attempt_at ASC
+        LIMIT @row_limit
+        FOR UPDATE OF webhook_deliveries SKIP LOCKED
+    )
+RETURNING webhook_deliveries.*, webhook_endpoints.url, webhook_endpoints.secret;
+
+-- name: RecordWebhookDeliveryAttempt :one
+-- Status is succeeded, failed, or pending with the delay until the next
+-- attempt.
+UPDATE webhook_deliveries
+SET status = @status,
+    attempts = attempts + 1,
+    next_attempt_at = NOW() + @retry_seconds::float8 * INTERVAL '1 second',
+    last_status_code = @last_status_code,
+    last_error = @last_error,
+    delivered_at = CASE WHEN @status = 'succeeded' THEN NOW() ELSE delivered_at END
+WHERE id = @id
+RETURNING *;
+
+-- name: ListWebhookDeliveries :many
+SELECT * FROM webhook_deliveries
+WHERE endpoint_id = $1
+ORDER BY created_at DESC
+LIMIT $2 OFFSET $3;
@@ -0,0 +1,42 @@
+-- name: CreateWebhookEvent :execrows
+-- Returns 0 rows if the event was already received.
+INSERT INTO webhook_events (id, received_at, source, event_type, payload, next_attempt_at)
+VALUES ($1, NOW(), $2, $3, $4, NOW())
+ON CONFLICT (id) DO NOTHING;
+
+-- name: ListDueWebhookEvents :many
+-- Locks the due events for this transaction, skipping any another worker
+-- holds, so each event is processed by one replica at a time.
+SELECT * FROM webhook_events
+WHERE status = 'pending' AND next_attempt_at <= NOW()
+ORDER BY received_at ASC
+LIMIT $1
+FOR UPDATE SKIP LOCKED;
+
+-- name: MarkWebhookEventProcessed :exec
+UPDATE webhook_events
+SET status = 'processed', attempts = attempts + 1, last_error = NULL, processed_at = NOW()
+WHERE id = $1;
+
+-- name: RetryWebhookEvent :exec
+UPDATE webhook_events
+SET attempts = attempts + 1, last_error = @last_error, next_attempt_at = NOW() + @retry_seconds::float8 * INTERVAL '1 second'
+WHERE id = @id;
+
+-- name: FailWebhookEvent :exec
+UPDATE webhook_events
+SET status = 'failed', attempts = attempts + 1, last_error = $2
+WHERE id = $1;
+
+-- name: ListWebhookEvents :many
+SELECT * FROM webhook_events
+WHERE status = $1
+ORDER BY received_at DESC
+LIMIT $2 OFFSET $3;
+
+-- name: ReplayWebhookEvent :execrows
+-- Only failed events can be replayed, so a processed event is never applied
+-- twice.
+UPDATE webhook_events
+SET status = 'pending', attempts = 0, last_error = NULL, next_attempt_at = NOW()
+WHERE id = $1 AND status = 'failed';
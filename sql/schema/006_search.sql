@@ -0,0 +1,15 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN handle TEXT UNIQUE,
+ADD COLUMN display_name TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX chirps_body_search_idx ON chirps USING GIN (to_tsvector('english', body));
+CREATE INDEX users_profile_search_idx ON users USING GIN (to_tsvector('simple', coalesce(handle, '') || ' ' || display_name));
+
+-- +goose Down
+DROP INDEX users_profile_search_idx;
+DROP INDEX chirps_body_search_idx;
+
+ALTER TABLE users
+DROP COLUMN display_name,
+DROP COLUMN handle;
@@ -0,0 +1,25 @@
+-- +goose Up
+CREATE TABLE stream_events (
+    id BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    type TEXT NOT NULL,
+    user_id UUID NOT NULL,
+    payload JSONB NOT NULL
+);
+
+-- +goose StatementBegin
+CREATE FUNCTION notify_stream_event() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('stream_events', json_build_object('id', NEW.id, 'type', NEW.type, 'user_id', NEW.user_id, 'payload', NEW.payload)::text);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER stream_events_notify AFTER INSERT ON stream_events
+FOR EACH ROW EXECUTE FUNCTION notify_stream_event();
+
+-- +goose Down
+DROP TRIGGER stream_events_notify ON stream_events;
+DROP FUNCTION notify_stream_event;
+DROP TABLE stream_events;
@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE chirps DROP CONSTRAINT chirps_body_key;
+-- Hash of the normalized body, used to reject reposts. Older chirps have
+-- none and are never treated as duplicates.
+ALTER TABLE chirps ADD COLUMN body_hash TEXT;
+CREATE INDEX chirps_user_id_body_hash_idx ON chirps (user_id, body_hash, created_at);
+
+-- +goose Down
+DROP INDEX chirps_user_id_body_hash_idx;
+ALTER TABLE chirps DROP COLUMN body_hash;
+ALTER TABLE chirps ADD CONSTRAINT chirps_body_key UNIQUE (body);
@@ -0,0 +1,34 @@
+-- +goose Up
+CREATE TABLE user_roles (
+    user_id UUID NOT NULL,
+    role TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, role),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE filter_rules (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    term TEXT NOT NULL UNIQUE,
+    action TEXT NOT NULL CHECK (action IN ('mask', 'reject', 'flag'))
+);
+
+-- The words cleanChirp used to mask.
+INSERT INTO filter_rules (id, created_at, term, action) VALUES
+    (gen_random_uuid(), NOW(), 'kerfuffle', 'mask'),
+    (gen_random_uuid(), NOW(), 'sharbert', 'mask'),
+    (gen_random_uuid(), NOW(), 'fornax', 'mask');
+
+CREATE TABLE content_flags (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    chirp_id UUID NOT NULL,
+    terms TEXT[] NOT NULL,
+    FOREIGN KEY (chirp_id) REFERENCES chirps (id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE content_flags;
+DROP TABLE filter_rules;
+DROP TABLE user_roles;
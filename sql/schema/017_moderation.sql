@@ -0,0 +1,64 @@
+-- +goose Up
+ALTER TABLE chirps ADD COLUMN hidden_at TIMESTAMP;
+
+CREATE TABLE reports (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    reporter_id UUID NOT NULL,
+    target_user_id UUID NOT NULL,
+    chirp_id UUID,
+    reason TEXT NOT NULL,
+    details TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'dismissed', 'actioned')),
+    resolved_at TIMESTAMP,
+    resolved_by UUID,
+    FOREIGN KEY (reporter_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (target_user_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (chirp_id) REFERENCES chirps (id) ON DELETE CASCADE
+);
+CREATE INDEX reports_status_created_at_idx ON reports (status, created_at);
+-- One open report per reporter and target.
+CREATE UNIQUE INDEX reports_open_unique_idx ON reports (reporter_id, target_user_id, COALESCE(chirp_id, '00000000-0000-0000-0000-000000000000'))
+    WHERE status = 'open';
+
+-- Suspensions without an end are bans.
+CREATE TABLE suspensions (
+    user_id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    until TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+-- The log keeps plain IDs rather than foreign keys so entries outlive the
+-- users and chirps they mention.
+CREATE TABLE moderation_actions (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    moderator_id UUID NOT NULL,
+    action TEXT NOT NULL,
+    report_id UUID,
+    target_user_id UUID,
+    chirp_id UUID,
+    note TEXT NOT NULL DEFAULT '',
+    expires_at TIMESTAMP
+);
+CREATE INDEX moderation_actions_target_user_id_idx ON moderation_actions (target_user_id, created_at);
+
+-- +goose StatementBegin
+CREATE FUNCTION reject_moderation_action_change() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'moderation_actions is append-only';
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER moderation_actions_immutable BEFORE UPDATE OR DELETE ON moderation_actions
+FOR EACH ROW EXECUTE FUNCTION reject_moderation_action_change();
+
+-- +goose Down
+DROP TRIGGER moderation_actions_immutable ON moderation_actions;
+DROP FUNCTION reject_moderation_action_change;
+DROP TABLE moderation_actions;
+DROP TABLE suspensions;
+DROP TABLE reports;
+ALTER TABLE chirps DROP COLUMN hidden_at;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- Delivery IDs of Polka webhooks already processed, so retries are no-ops.
+CREATE TABLE polka_deliveries (
+    id TEXT PRIMARY KEY,
+    received_at TIMESTAMP NOT NULL
+);
+
+-- +goose Down
+DROP TABLE polka_deliveries;
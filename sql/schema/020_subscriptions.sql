@@ -0,0 +1,32 @@
+-- +goose Up
+CREATE TABLE subscriptions (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL UNIQUE,
+    plan TEXT NOT NULL,
+    status TEXT NOT NULL CHECK (status IN ('active', 'past_due', 'canceled', 'expired', 'refunded')),
+    current_period_start TIMESTAMP NOT NULL,
+    -- NULL for upgrades from before subscriptions had periods; they don't
+    -- lapse on their own.
+    current_period_end TIMESTAMP,
+    cancel_at_period_end BOOL NOT NULL DEFAULT false,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+CREATE INDEX subscriptions_current_period_end_idx ON subscriptions (current_period_end)
+    WHERE status IN ('active', 'past_due');
+
+INSERT INTO subscriptions (id, created_at, updated_at, user_id, plan, status, current_period_start)
+SELECT gen_random_uuid(), NOW(), NOW(), id, 'red', 'active', updated_at
+FROM users WHERE is_chirpy_red;
+
+ALTER TABLE users DROP COLUMN is_chirpy_red;
+
+-- +goose Down
+ALTER TABLE users ADD COLUMN is_chirpy_red BOOL DEFAULT false;
+UPDATE users SET is_chirpy_red = true
+WHERE id IN (
+    SELECT user_id FROM subscriptions
+    WHERE status IN ('active', 'past_due') AND (current_period_end IS NULL OR current_period_end > NOW())
+);
+DROP TABLE subscriptions;
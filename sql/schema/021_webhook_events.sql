@@ -0,0 +1,31 @@
+-- +goose Up
+-- Every verified incoming webhook, stored before it is processed. The ID is
+-- the sender's delivery ID, so redeliveries are dropped on insert.
+CREATE TABLE webhook_events (
+    id TEXT PRIMARY KEY,
+    received_at TIMESTAMP NOT NULL,
+    source TEXT NOT NULL,
+    event_type TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'processed', 'failed')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL,
+    last_error TEXT,
+    processed_at TIMESTAMP
+);
+CREATE INDEX webhook_events_due_idx ON webhook_events (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX webhook_events_status_idx ON webhook_events (status, received_at);
+
+INSERT INTO webhook_events (id, received_at, source, event_type, payload, status, next_attempt_at, processed_at)
+SELECT id, received_at, 'polka', '', '{}', 'processed', received_at, received_at FROM polka_deliveries;
+
+DROP TABLE polka_deliveries;
+
+-- +goose Down
+CREATE TABLE polka_deliveries (
+    id TEXT PRIMARY KEY,
+    received_at TIMESTAMP NOT NULL
+);
+INSERT INTO polka_deliveries (id, received_at)
+SELECT id, received_at FROM webhook_events WHERE source = 'polka' AND status = 'processed';
+DROP TABLE webhook_events;
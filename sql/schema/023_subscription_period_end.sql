@@ -0,0 +1,9 @@
+-- +goose Up
+-- Subscriptions migrated from is_chirpy_red had no period end, so canceling
+-- them never took effect. They get one period from now, like a new upgrade.
+UPDATE subscriptions SET current_period_end = NOW() + INTERVAL '30 days', updated_at = NOW()
+WHERE current_period_end IS NULL;
+ALTER TABLE subscriptions ALTER COLUMN current_period_end SET NOT NULL;
+
+-- +goose Down
+ALTER TABLE subscriptions ALTER COLUMN current_period_end DROP NOT NULL;
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/curtisbraxdale/chirpy/internal/pubsub"
+	"github.com/google/uuid"
+)
+
+const streamHeartbeat = 25 * time.Second
+
+// streamFilter builds the event filter for a viewer. Chirp events from users
+// blocked either way are always hidden, and the home stream also hides muted
+// users. Notifications and direct messages only go to their recipient.
+func (cfg *apiConfig) streamFilter(viewerID uuid.NullUUID, filter string, authorID uuid.UUID) (func(pubsub.Event) bool, error) {
+	hidden := map[uuid.UUID]bool{}
+	if viewerID.Valid {
+		blocked, err := cfg.queries.GetBlockedUserIDs(context.Background(), viewerID.UUID)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range blocked {
+			hidden[id] = true
+		}
+		if filter == "home" {
+			muted, err := cfg.queries.GetMutedUserIDs(context.Background(), viewerID.UUID)
+			if err != nil {
+				return nil, err
+			}
+			for _, id := range muted {
+				hidden[id] = true
+			}
+		}
+	}
+	return func(e pubsub.Event) bool {
+		if e.Type == pubsub.Notification || e.Type == pubsub.MessageCreated {
+			return viewerID.Valid && e.UserID == viewerID.UUID
+		}
+		if e.Type == pubsub.Typing || hidden[e.UserID] {
+			return false
+		}
+		if filter == "author" {
+			return e.UserID == authorID
+		}
+		return true
+	}, nil
+}
+
+func writeStreamEvent(w http.ResponseWriter, e pubsub.Event) error {
+	_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, e.Payload)
+	return err
+}
+
+func (cfg *apiConfig) streamHandler(w http.ResponseWriter, req *http.Request) {
+	viewerID := cfg.optionalUserID(req)
+	filter := req.URL.Query().Get("filter")
+	authorID := uuid.Nil
+	switch filter {
+	case "", "global":
+		filter = "global"
+	case "author":
+		parsed, err := uuid.Parse(req.URL.Query().Get("author_id"))
+		if err != nil {
+			respondWithError(w, 400, "author_id is required for the author filter")
+			return
+		}
+		authorID = parsed
+	case "home":
+		if !viewerID.Valid {
+			w.WriteHeader(401)
+			return
+		}
+	default:
+		respondWithError(w, 400, "filter must be global, author or home")
+		return
+	}
+
+	// Browsers send Last-Event-ID on reconnect; the query parameter is for
+	// clients that can't set headers on the first request.
+	lastIDString := req.Header.Get("Last-Event-ID")
+	if lastIDString == "" {
+		lastIDString = req.URL.Query().Get("last_event_id")
+	}
+	lastID := int64(0)
+	if lastIDString != "" {
+		parsed, err := strconv.ParseInt(lastIDString, 10, 64)
+		if err != nil {
+			respondWithError(w, 400, "Invalid Last-Event-ID")
+			return
+		}
+		lastID = parsed
+	}
+
+	accept, err := cfg.streamFilter(viewerID, filter, authorID)
+	if err != nil {
+		requestLogger(req).Error("Error building stream filter", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	// Subscribe before replaying so nothing published in between is missed.
+	sub := cfg.broker.Hub.Subscribe(accept)
+	defer sub.Close()
+
+	backlog := []pubsub.Event{}
+	complete := true
+	if lastID > 0 {
+		backlog, complete, err = cfg.broker.Replay(context.Background(), lastID)
+		if err != nil {
+			requestLogger(req).Error("Error replaying stream events", "error", err)
+			w.WriteHeader(500)
+			return
+		}
+	}
+
+	// Streams outlive the server's write timeout.
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(200)
+
+	if !complete {
+		// No ID, so reconnecting before any new event asks for a reset
+		// again.
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: {}\n\n", pubsub.Reset); err != nil {
+			return
+		}
+	}
+	// Events can commit out of ID order, so live events are only skipped if
+	// the backlog already had them.
+	replayed := map[int64]bool{}
+	for _, e := range backlog {
+		replayed[e.ID] = true
+		if !accept(e) {
+			continue
+		}
+		if err := writeStreamEvent(w, e); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-cfg.shutdown:
+			// The client reconnects to another replica and resumes.
+			return
+		case e, ok := <-sub.Events():
+			// A closed channel means we fell too far behind; the client
+			// reconnects and resumes from its last event.
+			if !ok {
+				return
+			}
+			if replayed[e.ID] {
+				continue
+			}
+			if err := writeStreamEvent(w, e); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/curtisbraxdale/chirpy/internal/audit"
+	"github.com/curtisbraxdale/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// Polka events that change a subscription.
+const (
+	polkaUpgraded      = "user.upgraded"
+	polkaDowngraded    = "user.downgraded"
+	polkaRenewed       = "subscription.renewed"
+	polkaCanceled      = "subscription.canceled"
+	polkaPaymentFailed = "subscription.payment_failed"
+	polkaRefunded      = "subscription.refunded"
+)
+
+const (
+	planRed = "red"
+	// subscriptionPeriod is used when Polka doesn't say when a period ends.
+	subscriptionPeriod         = 30 * 24 * time.Hour
+	subscriptionExpiryInterval = 10 * time.Minute
+)
+
+// polkaEvent is the part of a Polka webhook that describes a subscription
+// change.
+type polkaEvent struct {
+	Event string `json:"event"`
+	Data  struct {
+		UserID    string     `json:"user_id"`
+		Plan      string     `json:"plan"`
+		PeriodEnd *time.Time `json:"period_end"`
+	} `json:"data"`
+}
+
+func isSubscriptionEvent(event string) bool {
+	switch event {
+	case polkaUpgraded, polkaDowngraded, polkaRenewed, polkaCanceled, polkaPaymentFailed, polkaRefunded:
+		return true
+	}
+	return false
+}
+
+// applySubscriptionEvent applies the Polka event with ID eventID to the
+// user's subscription and audits the change. Events for a user without a
+// subscription that only change an existing one do nothing.
+func applySubscriptionEvent(q *database.Queries, eventID string, userID uuid.UUID, event polkaEvent, auditEvent audit.Event) error {
+	before, err := q.GetSubscription(context.Background(), userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	plan := event.Data.Plan
+	if plan == "" {
+		plan = planRed
+	}
+	switch event.Event {
+	case polkaUpgraded, polkaRenewed:
+		// The period is worked out in SQL, so it compares correctly with
+		// NOW() whatever the database's time zone.
+		upsertParams := database.UpsertSubscriptionParams{UserID: userID, Plan: plan, PeriodSeconds: int64(subscriptionPeriod.Seconds()), Renewal: event.Event == polkaRenewed}
+		if event.Data.PeriodEnd != nil {
+			upsertParams.PeriodEnd = sql.NullTime{Time: *event.Data.PeriodEnd, Valid: true}
+		}
+		_, err = q.UpsertSubscription(context.Background(), upsertParams)
+	case polkaPaymentFailed:
+		// Past due keeps Chirpy Red until the period ends, giving Polka time
+		// to retry the payment.
+		_, err = q.MarkSubscriptionPastDue(context.Background(), userID)
+	case polkaCanceled:
+		_, err = q.CancelSubscriptionAtPeriodEnd(context.Background(), userID)
+	case polkaDowngraded:
+		_, err = q.EndSubscription(context.Background(), database.EndSubscriptionParams{UserID: userID, Status: "canceled"})
+	case polkaRefunded:
+		_, err = q.EndSubscription(context.Background(), database.EndSubscriptionParams{UserID: userID, Status: "refunded"})
+	}
+	if err != nil {
+		return err
+	}
+
+	after, err := q.GetSubscription(context.Background(), userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	auditEvent.TargetType, auditEvent.TargetID = "user", userID.String()
+	auditEvent.Before = subscriptionAuditFields(before)
+	auditEvent.After = subscriptionAuditFields(after)
+	auditEvent.After["webhook_event_id"] = eventID
+	return audit.Record(context.Background(), q, auditEvent)
+}
+
+func subscriptionAuditFields(s database.Subscription) map[string]any {
+	if s.ID == uuid.Nil {
+		return map[string]any{}
+	}
+	return map[string]any{"plan": s.Plan, "status": s.Status, "cancel_at_period_end": s.CancelAtPeriodEnd, "current_period_end": s.CurrentPeriodEnd}
+}
+
+// runSubscriptionExpiry moves subscriptions past the end of their period to
+// canceled or expired. Chirpy Red already ends at the period end; this keeps
+// the stored status honest.
+func (cfg *apiConfig) runSubscriptionExpiry(ctx context.Context) {
+	ticker := time.NewTicker(subscriptionExpiryInterval)
+	defer ticker.Stop()
+	for {
+		expired, err := cfg.queries.ExpireSubscriptions(context.Background())
+		if err != nil {
+			slog.Error("Error expiring subscriptions", "error", err)
+		} else if expired > 0 {
+			slog.Info("Expired subscriptions", "count", expired)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
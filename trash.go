@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/curtisbraxdale/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const purgeInterval = time.Hour
+
+// unattachedMediaMaxAge is how long an upload may wait to be attached to a
+// chirp before it is deleted.
+const unattachedMediaMaxAge = 24 * time.Hour
+
+// TrashedChirp is a soft-deleted chirp the author can still restore.
+type TrashedChirp struct {
+	Chirp
+	DeletedAt    time.Time `json:"deleted_at"`
+	RestoreUntil time.Time `json:"restore_until"`
+}
+
+func (cfg *apiConfig) listTrashHandler(w http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		respondAuthError(w, req, err)
+		return
+	}
+	listParams := database.ListDeletedChirpsParams{UserID: userID, RestoreSeconds: int64(cfg.restoreWindow.Seconds())}
+	dbChirps, err := cfg.queries.ListDeletedChirps(context.Background(), listParams)
+	if err != nil {
+		requestLogger(req).Error("Error listing deleted chirps", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	chirps := []Chirp{}
+	for _, c := range dbChirps {
+		chirps = append(chirps, Chirp{ID: c.ID, CreatedAt: c.CreatedAt, UpdatedAt: c.UpdatedAt, Body: c.Body, UserID: c.UserID})
+	}
+	err = cfg.loadChirpDetails(chirps, uuid.NullUUID{UUID: userID, Valid: true})
+	if err != nil {
+		requestLogger(req).Error("Error getting chirp details", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	trash := []TrashedChirp{}
+	for i, c := range dbChirps {
+		trash = append(trash, TrashedChirp{Chirp: chirps[i], DeletedAt: c.DeletedAt.Time, RestoreUntil: c.DeletedAt.Time.Add(cfg.restoreWindow)})
+	}
+	respondWithJSON(w, 200, trash)
+}
+
+func (cfg *apiConfig) restoreChirpHandler(w http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.authenticatedUserID(req)
+	if err != nil {
+		respondAuthError(w, req, err)
+		return
+	}
+	chirpID, err := uuid.Parse(req.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, 400, "Invalid chirp ID")
+		return
+	}
+	// Only the author can restore, and only within the window.
+	restoreParams := database.RestoreChirpParams{ID: chirpID, UserID: userID, RestoreSeconds: int64(cfg.restoreWindow.Seconds())}
+	dbChirp, err := cfg.queries.RestoreChirp(context.Background(), restoreParams)
+	if errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(404)
+		return
+	}
+	if err != nil {
+		requestLogger(req).Error("Error restoring chirp", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	chirps := []Chirp{{ID: dbChirp.ID, CreatedAt: dbChirp.CreatedAt, UpdatedAt: dbChirp.UpdatedAt, Body: dbChirp.Body, UserID: dbChirp.UserID}}
+	err = cfg.loadChirpDetails(chirps, uuid.NullUUID{UUID: userID, Valid: true})
+	if err != nil {
+		requestLogger(req).Error("Error getting chirp details", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	respondWithJSON(w, 200, chirps[0])
+}
+
+// runTrashPurge hard-deletes chirps once their restore window has passed,
+// along with their media and any uploads that were never attached to a chirp.
+func (cfg *apiConfig) runTrashPurge(ctx context.Context) {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+	for {
+		cfg.purgeDeletedChirps(ctx)
+		cfg.purgeUnattachedMedia(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (cfg *apiConfig) purgeDeletedChirps(ctx context.Context) {
+	rows, err := cfg.queries.PurgeDeletedChirps(context.Background(), int64(cfg.restoreWindow.Seconds()))
+	if err != nil {
+		slog.Error("Error purging deleted chirps", "error", err)
+		return
+	}
+	purged := map[uuid.UUID]bool{}
+	for _, row := range rows {
+		purged[row.ID] = true
+		if row.StorageKey.Valid {
+			cfg.deleteMediaFiles(ctx, row.StorageKey.String, row.ThumbnailKey.String)
+		}
+	}
+	if len(purged) > 0 {
+		slog.Info("Purged deleted chirps", "count", len(purged))
+	}
+}
+
+func (cfg *apiConfig) purgeUnattachedMedia(ctx context.Context) {
+	media, err := cfg.queries.DeleteUnattachedMedia(context.Background(), int64(unattachedMediaMaxAge.Seconds()))
+	if err != nil {
+		slog.Error("Error deleting unattached media", "error", err)
+		return
+	}
+	for _, m := range media {
+		cfg.deleteMediaFiles(ctx, m.StorageKey, m.ThumbnailKey)
+	}
+	if len(media) > 0 {
+		slog.Info("Deleted unattached media", "count", len(media))
+	}
+}
+
+// deleteMediaFiles removes stored files whose media rows are already gone.
+// Failures are only logged, since nothing references the files any more.
+func (cfg *apiConfig) deleteMediaFiles(ctx context.Context, keys ...string) {
+	for _, key := range keys {
+		if err := cfg.store.Delete(ctx, key); err != nil {
+			slog.Error("Error deleting media file", "key", key, "error", err)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/curtisbraxdale/chirpy/internal/auth"
+	"github.com/curtisbraxdale/chirpy/internal/pubsub"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	wsWriteWait   = 10 * time.Second
+	wsPongWait    = 60 * time.Second
+	wsPingPeriod  = wsPongWait * 9 / 10
+	wsMaxMessage  = 4096
+	wsMaxTopics   = 50
+	wsReplyBuffer = 16
+	// Typing signals go to every instance, so each connection may only send
+	// one per topic this often.
+	wsTypingInterval = 3 * time.Second
+	// wsProtocol is the subprotocol the server speaks. Browsers can't set
+	// headers on the handshake, so clients offer it alongside
+	// wsTokenPrefix+token, which keeps the token out of URLs and logs.
+	wsProtocol    = "chirpy.v1"
+	wsTokenPrefix = "bearer."
+)
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	Subprotocols:    []string{wsProtocol},
+}
+
+// checkOrigin allows handshakes without an Origin, which don't come from
+// browsers, and those from the server's own host or a configured origin.
+func (cfg *apiConfig) checkOrigin(req *http.Request) bool {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, req.Host) {
+		return true
+	}
+	return slices.Contains(cfg.allowedOrigins, strings.ToLower(u.Scheme+"://"+u.Host))
+}
+
+// websocketToken returns the bearer token from the Authorization header, or
+// from the subprotocols offered by a browser.
+func websocketToken(req *http.Request) string {
+	token, err := auth.GetBearerToken(req.Header)
+	if err == nil && token != "" {
+		return token
+	}
+	for _, protocol := range websocket.Subprotocols(req) {
+		if token, ok := strings.CutPrefix(protocol, wsTokenPrefix); ok {
+			return token
+		}
+	}
+	return ""
+}
+
+type wsClientMessage struct {
+	Type  string `json:"type"`
+	Topic string `json:"topic"`
+}
+
+type wsServerMessage struct {
+	Type    string          `json:"type"`
+	Topic   string          `json:"topic,omitempty"`
+	Event   string          `json:"event,omitempty"`
+	ID      int64           `json:"id,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	Message string          `json:"message,omitempty"`
+}
+
+// wsClient is one live connection. Its queue is bounded twice over: events
+// wait in its hub subscription and replies in a small channel, and filling
+// either one closes the connection instead of blocking anybody else.
+type wsClient struct {
+	userID     uuid.UUID
+	hidden     map[uuid.UUID]bool
+	mu         sync.Mutex
+	topics     map[string]pubsub.Topic
+	lastTyping map[string]time.Time
+	replies    chan wsServerMessage
+}
+
+// match returns the first subscribed topic the event belongs to.
+func (c *wsClient) match(e pubsub.Event) (pubsub.Topic, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, topic := range c.topics {
+		if topic.Matches(e) {
+			return topic, true
+		}
+	}
+	return pubsub.Topic{}, false
+}
+
+func (c *wsClient) accepts(e pubsub.Event) bool {
+	if e.Type == pubsub.Notification || e.Type == pubsub.MessageCreated || c.hidden[e.UserID] {
+		return false
+	}
+	if e.Type == pubsub.Typing && e.UserID == c.userID {
+		return false
+	}
+	_, ok := c.match(e)
+	return ok
+}
+
+// reply queues a message for the writer, reporting false if the queue is full.
+func (c *wsClient) reply(msg wsServerMessage) bool {
+	select {
+	case c.replies <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+func (cfg *apiConfig) websocketHandler(w http.ResponseWriter, req *http.Request) {
+	userID, err := cfg.validateToken(websocketToken(req))
+	if err != nil {
+		respondAuthError(w, req, err)
+		return
+	}
+	blocked, err := cfg.queries.GetBlockedUserIDs(context.Background(), userID)
+	if err != nil {
+		requestLogger(req).Error("Error getting blocked users", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+
+	upgrader := wsUpgrader
+	upgrader.CheckOrigin = cfg.checkOrigin
+	conn, err := upgrader.Upgrade(w, req, nil)
+	if err != nil {
+		// Upgrade has already written the error response.
+		requestLogger(req).Error("Error upgrading websocket", "error", err)
+		return
+	}
+	client := &wsClient{
+		userID:     userID,
+		hidden:     map[uuid.UUID]bool{},
+		topics:     map[string]pubsub.Topic{},
+		lastTyping: map[string]time.Time{},
+		replies:    make(chan wsServerMessage, wsReplyBuffer),
+	}
+	for _, id := range blocked {
+		client.hidden[id] = true
+	}
+
+	sub := cfg.broker.Hub.Subscribe(client.accepts)
+	defer sub.Close()
+	done := make(chan struct{})
+	go client.writePump(conn, sub, done, cfg.shutdown)
+	cfg.wsReadPump(conn, client)
+	close(done)
+}
+
+func (cfg *apiConfig) wsReadPump(conn *websocket.Conn, client *wsClient) {
+	conn.SetReadLimit(wsMaxMessage)
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+	for {
+		_, dat, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				slog.Error("Error reading websocket", "error", err)
+			}
+			return
+		}
+		msg := wsClientMessage{}
+		if err := json.Unmarshal(dat, &msg); err != nil {
+			if !client.reply(wsServerMessage{Type: "error", Message: "Invalid JSON"}) {
+				return
+			}
+			continue
+		}
+		if !client.reply(cfg.handleWSMessage(client, msg)) {
+			return
+		}
+	}
+}
+
+func (cfg *apiConfig) handleWSMessage(client *wsClient, msg wsClientMessage) wsServerMessage {
+	if msg.Type == "ping" {
+		return wsServerMessage{Type: "pong"}
+	}
+	topic, err := pubsub.ParseTopic(msg.Topic)
+	if err != nil {
+		return wsServerMessage{Type: "error", Topic: msg.Topic, Message: err.Error()}
+	}
+	key := topic.String()
+
+	switch msg.Type {
+	case "subscribe":
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		if _, ok := client.topics[key]; !ok && len(client.topics) >= wsMaxTopics {
+			return wsServerMessage{Type: "error", Topic: key, Message: "Too many subscriptions"}
+		}
+		client.topics[key] = topic
+		return wsServerMessage{Type: "subscribed", Topic: key}
+	case "unsubscribe":
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		delete(client.topics, key)
+		return wsServerMessage{Type: "unsubscribed", Topic: key}
+	case "typing":
+		// The hub calls match under the client lock, so don't hold it while
+		// talking to the database.
+		client.mu.Lock()
+		_, subscribed := client.topics[key]
+		throttled := time.Since(client.lastTyping[key]) < wsTypingInterval
+		if subscribed && !throttled {
+			client.lastTyping[key] = time.Now()
+		}
+		client.mu.Unlock()
+		if !subscribed {
+			return wsServerMessage{Type: "error", Topic: key, Message: "Subscribe before sending typing"}
+		}
+		if !throttled {
+			err := cfg.broker.Signal(context.Background(), pubsub.Typing, client.userID, map[string]interface{}{"topic": key, "user_id": client.userID})
+			if err != nil {
+				slog.Error("Error signalling typing", "error", err)
+				return wsServerMessage{Type: "error", Topic: key, Message: "Couldn't send typing"}
+			}
+		}
+		return wsServerMessage{Type: "typing", Topic: key}
+	}
+	return wsServerMessage{Type: "error", Message: "Unknown message type"}
+}
+
+func (c *wsClient) writePump(conn *websocket.Conn, sub *pubsub.Subscription, done, shutdown chan struct{}) {
+	ticker := time.NewTicker(wsPingPeriod)
+	defer ticker.Stop()
+	defer conn.Close()
+	closeWith := func(code int, text string) {
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(wsWriteWait))
+	}
+	for {
+		select {
+		case <-done:
+			closeWith(websocket.CloseNormalClosure, "")
+			return
+		case <-shutdown:
+			closeWith(websocket.CloseGoingAway, "Server shutting down")
+			return
+		case e, ok := <-sub.Events():
+			if !ok {
+				closeWith(websocket.CloseTryAgainLater, "Too far behind")
+				return
+			}
+			topic, ok := c.match(e)
+			if !ok {
+				continue
+			}
+			conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			err := conn.WriteJSON(wsServerMessage{Type: "event", Topic: topic.String(), Event: e.Type, ID: e.ID, Data: e.Payload})
+			if err != nil {
+				return
+			}
+		case msg := <-c.replies:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := conn.WriteJSON(msg); err != nil {
+				return
+			}
+		case <-ticker.C:
+			err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait))
+			if err != nil {
+				return
+			}
+		}
+	}
+}